@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	ics "github.com/arran4/golang-ical"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	absoluteTriggerRegex = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}`)
+	dayTriggerRegex      = regexp.MustCompile(`^(\d+)([dw])$`)
+	legacyReminderRegex  = regexp.MustCompile(`^(\d+[HMS])+$`)
+)
+
+type alarmTrigger struct {
+	value    string
+	absolute bool
+}
+
+// parseAlarmTrigger parses a trigger of the alarm module. Triggers are either
+//   - relative to the start of the event: a duration before the start, e.g. "15m", "1h30m", "2d" or "1w".
+//     With a leading "+", the alarm is after the start. RFC 5545 durations like "-PT15M" are used as they are.
+//   - absolute: a time expression starting with a date, e.g. "2024-01-05T08:00:00" or "2024-01-05-1d", see parseTimeExpression
+func parseAlarmTrigger(trigger string, loc *time.Location) (alarmTrigger, error) {
+	trigger = strings.TrimSpace(trigger)
+	if absoluteTriggerRegex.MatchString(trigger) {
+		t, err := parseTimeExpression(trigger, loc)
+		if err != nil {
+			return alarmTrigger{}, fmt.Errorf("invalid trigger '%s': %s", trigger, err.Error())
+		}
+		return alarmTrigger{value: t.UTC().Format(icalDateTimeFormatUTC), absolute: true}, nil
+	}
+	if strings.Contains(trigger, "P") {
+		if _, err := parseICalDuration(trigger); err != nil {
+			return alarmTrigger{}, fmt.Errorf("invalid trigger '%s': %s", trigger, err.Error())
+		}
+		return alarmTrigger{value: trigger}, nil
+	}
+	after := strings.HasPrefix(trigger, "+")
+	value := strings.TrimPrefix(strings.TrimPrefix(trigger, "+"), "-")
+	var d time.Duration
+	if m := dayTriggerRegex.FindStringSubmatch(value); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		d = time.Duration(n) * 24 * time.Hour
+		if m[2] == "w" {
+			d *= 7
+		}
+	} else {
+		var err error
+		d, err = time.ParseDuration(value)
+		if err != nil || d < 0 {
+			return alarmTrigger{}, fmt.Errorf("invalid trigger '%s', must be a duration like '15m' or '2d', or a date", trigger)
+		}
+	}
+	if !after {
+		d = -d
+	}
+	return alarmTrigger{value: formatICalDuration(d)}, nil
+}
+
+// parseLegacyReminder converts the time of the add-reminder module and the ?reminder= query, which was appended to "-PT",
+// e.g. "15M" or "1H30M". Other values are parsed as triggers of the alarm module.
+func parseLegacyReminder(reminder string) (alarmTrigger, error) {
+	if legacyReminderRegex.MatchString(reminder) {
+		return alarmTrigger{value: "-PT" + reminder}, nil
+	}
+	return parseAlarmTrigger(reminder, time.UTC)
+}
+
+// parseAlarmParams checks the parameters of the alarm module and returns the triggers
+func parseAlarmParams(params map[string]string, loc *time.Location) ([]alarmTrigger, error) {
+	if strings.TrimSpace(params["triggers"]) == "" {
+		return nil, fmt.Errorf("missing mandatory Parameter 'triggers'")
+	}
+	var triggers []alarmTrigger
+	for _, t := range strings.Split(params["triggers"], ",") {
+		if strings.TrimSpace(t) == "" {
+			continue
+		}
+		trigger, err := parseAlarmTrigger(t, loc)
+		if err != nil {
+			return nil, err
+		}
+		triggers = append(triggers, trigger)
+	}
+	switch strings.ToUpper(params["action"]) {
+	case "", string(ics.ActionDisplay), string(ics.ActionAudio):
+	case string(ics.ActionEmail):
+		if params["attendee"] == "" {
+			return nil, fmt.Errorf("missing mandatory Parameter 'attendee' for EMAIL alarms")
+		}
+		for _, mail := range strings.Split(params["attendee"], ",") {
+			if !validMail(strings.TrimSpace(mail)) {
+				return nil, fmt.Errorf("invalid attendee '%s'", strings.TrimSpace(mail))
+			}
+		}
+	default:
+		return nil, fmt.Errorf("invalid action '%s', must be 'DISPLAY', 'AUDIO' or 'EMAIL'", params["action"])
+	}
+	switch params["existing"] {
+	case "", "keep", "replace":
+	default:
+		return nil, fmt.Errorf("invalid value for 'existing', must be 'keep' or 'replace'")
+	}
+	return triggers, nil
+}
+
+// addAlarm adds an alarm with the trigger and action to the event or todo, unless it already has one with the same trigger and action.
+// Relative triggers of todos without DTSTART are relative to DUE, todos without both only get absolute triggers.
+// Returns true, if the alarm was added.
+func addAlarm(item *ics.ComponentBase, trigger alarmTrigger, action ics.Action, params map[string]string) bool {
+	for _, c := range item.Components {
+		if alarm, ok := c.(*ics.VAlarm); ok &&
+			getPropertyValue(&alarm.ComponentBase, ics.ComponentPropertyTrigger) == trigger.value &&
+			getPropertyValue(&alarm.ComponentBase, ics.ComponentPropertyAction) == string(action) {
+			return false
+		}
+	}
+	var triggerParams []ics.PropertyParameter
+	if trigger.absolute {
+		triggerParams = append(triggerParams, ics.WithValue(string(ics.ValueDataTypeDateTime)))
+	} else if item.GetProperty(ics.ComponentPropertyDtStart) == nil {
+		// only todos can lack DTSTART, the trigger must then be related to DUE
+		if item.GetProperty(ics.ComponentProperty(ics.PropertyDue)) == nil {
+			return false
+		}
+		triggerParams = append(triggerParams, &ics.KeyValues{Key: string(ics.ParameterRelated), Value: []string{"END"}})
+	}
+	alarm := &ics.VAlarm{}
+	item.Components = append(item.Components, alarm)
+	alarm.SetAction(action)
+	alarm.SetTrigger(trigger.value, triggerParams...)
+	summary := getPropertyValue(item, ics.ComponentPropertySummary)
+	description := summary
+	if params["description"] != "" {
+		description = ics.ToText(params["description"])
+	}
+	switch action {
+	case ics.ActionDisplay:
+		alarm.SetProperty(ics.ComponentPropertyDescription, description)
+	case ics.ActionAudio:
+		if params["attach"] != "" {
+			alarm.SetProperty(ics.ComponentPropertyAttach, params["attach"])
+		}
+	case ics.ActionEmail:
+		if params["summary"] != "" {
+			summary = ics.ToText(params["summary"])
+		}
+		alarm.SetProperty(ics.ComponentPropertySummary, summary)
+		alarm.SetProperty(ics.ComponentPropertyDescription, description)
+		for _, mail := range strings.Split(params["attendee"], ",") {
+			alarm.AddProperty(ics.ComponentPropertyAttendee, "mailto:"+strings.TrimSpace(mail))
+		}
+	}
+	return true
+}
+
+// This module adds alarms (VALARM) to events and todos. Several triggers per event are possible.
+// Journal entries are skipped, as RFC 5545 doesn't allow alarms in them. Relative triggers of todos without DTSTART
+// are relative to DUE, todos without both only get absolute triggers.
+// Parameters:
+// - 'triggers', mandatory: comma separated list of triggers. Durations like "15m", "1h30m", "2d" or "1w" are before the start
+// of the event, with a leading "+" after it. RFC 5545 durations like "-PT15M" are used as they are.
+// Values starting with a date are absolute, e.g. "2024-01-05T08:00:00", see parseTimeExpression.
+// - 'action', default "DISPLAY": "DISPLAY", "AUDIO" or "EMAIL"
+// - 'description', default is the summary of the event: text of DISPLAY and EMAIL alarms
+// - 'summary', default is the summary of the event: subject of EMAIL alarms
+// - 'attendee', mandatory for EMAIL: comma separated list of mail addresses
+// - 'attach', optional: URL of the sound of AUDIO alarms
+// - 'existing', default "keep": "keep" keeps the existing alarms of the event, "replace" removes them
+// - match rules, 'combine', 'after', 'before', 'period', optional: only add alarms to matching events, see parseEventMatcher
+// Returns the number of events removed or added (always 0).
+func moduleAlarm(cal *ics.Calendar, params map[string]string) (int, error) {
+	loc, err := getParamLocation(params)
+	if err != nil {
+		return 0, err
+	}
+	triggers, err := parseAlarmParams(params, loc)
+	if err != nil {
+		return 0, err
+	}
+	action := ics.ActionDisplay
+	if params["action"] != "" {
+		action = ics.Action(strings.ToUpper(params["action"]))
+	}
+	matcher, err := parseEventMatcher(params)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, component := range cal.Components {
+		switch component.(type) {
+		case *ics.VEvent, *ics.VTodo: // RFC 5545 doesn't allow alarms in journal entries
+			item := getItemBase(component)
+			matched, err := matcher.matches(component)
+			if err != nil {
+				log.Warnf("Skipping event: %s", err.Error())
+				continue
+			}
+			if !matched {
+				continue
+			}
+			if params["existing"] == "replace" {
+				var components []ics.Component
+				for _, c := range item.Components {
+					if _, ok := c.(*ics.VAlarm); !ok {
+						components = append(components, c)
+					}
+				}
+				item.Components = components
+			}
+			for _, trigger := range triggers {
+				if addAlarm(item, trigger, action, params) {
+					log.Debug("Added alarm " + trigger.value + " to " + getItemType(component) + " with id " + getItemId(item) + "\n")
+				}
+			}
+		}
+	}
+	return 0, nil
+}
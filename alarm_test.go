@@ -0,0 +1,150 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	ics "github.com/arran4/golang-ical"
+)
+
+func TestParseAlarmTrigger(t *testing.T) {
+	tests := []struct {
+		trigger  string
+		want     string
+		absolute bool
+	}{
+		{"15m", "-PT15M", false},
+		{" 1h30m ", "-PT1H30M", false},
+		{"+10m", "PT10M", false},
+		{"2d", "-P2D", false},
+		{"1w", "-P7D", false},
+		{"-PT15M", "-PT15M", false},
+		{"2024-01-05T08:00:00", "20240105T080000Z", true},
+		{"2024-01-05-1d", "20240104T000000Z", true},
+	}
+	for _, test := range tests {
+		trigger, err := parseAlarmTrigger(test.trigger, time.UTC)
+		if err != nil {
+			t.Errorf("parseAlarmTrigger(%q): unexpected error: %v", test.trigger, err)
+			continue
+		}
+		if trigger.value != test.want || trigger.absolute != test.absolute {
+			t.Errorf("parseAlarmTrigger(%q) = %+v, want %s", test.trigger, trigger, test.want)
+		}
+	}
+	for _, trigger := range []string{"soon", "-5x", "PT", "2024-13-01"} {
+		if _, err := parseAlarmTrigger(trigger, time.UTC); err == nil {
+			t.Errorf("parseAlarmTrigger(%q): expected an error", trigger)
+		}
+	}
+
+	for reminder, want := range map[string]string{"15M": "-PT15M", "1H30M": "-PT1H30M", "2d": "-P2D"} {
+		if trigger, err := parseLegacyReminder(reminder); err != nil || trigger.value != want {
+			t.Errorf("parseLegacyReminder(%q) = %+v, %v, want %s", reminder, trigger, err, want)
+		}
+	}
+}
+
+// alarmTriggers returns the "ACTION TRIGGER" of the alarms of each item
+func alarmTriggers(cal *ics.Calendar) map[string]string {
+	triggers := make(map[string]string)
+	for _, component := range cal.Components {
+		item := getItemBase(component)
+		if item == nil {
+			continue
+		}
+		var alarms []string
+		for _, c := range item.Components {
+			if alarm, ok := c.(*ics.VAlarm); ok {
+				alarms = append(alarms, getPropertyValue(&alarm.ComponentBase, ics.ComponentPropertyAction)+" "+
+					getPropertyValue(&alarm.ComponentBase, ics.ComponentPropertyTrigger))
+			}
+		}
+		triggers[getItemId(item)] = strings.Join(alarms, ",")
+	}
+	return triggers
+}
+
+func TestModuleAlarm(t *testing.T) {
+	items := strings.Join([]string{
+		testEvent("event", "Vorlesung", "20240105T100000", "20240105T120000",
+			"BEGIN:VALARM", "ACTION:DISPLAY", "TRIGGER:-PT15M", "DESCRIPTION:Vorlesung", "END:VALARM",
+			"BEGIN:VALARM", "ACTION:AUDIO", "TRIGGER:-PT5M", "END:VALARM"),
+		testEvent("other", "Sport", "20240105T180000", "20240105T190000"),
+		"BEGIN:VTODO\nUID:due\nDTSTAMP:20240101T000000Z\nDUE:20240110T120000Z\nSUMMARY:Abgabe\nEND:VTODO",
+		"BEGIN:VTODO\nUID:undated\nDTSTAMP:20240101T000000Z\nSUMMARY:Irgendwann\nEND:VTODO",
+		"BEGIN:VJOURNAL\nUID:journal\nDTSTAMP:20240101T000000Z\nDTSTART:20240105T100000Z\nSUMMARY:Notiz\nEND:VJOURNAL",
+	}, "\n")
+
+	tests := []struct {
+		params map[string]string
+		want   map[string]string
+	}{
+		// the existing DISPLAY alarm 15 minutes before isn't added again
+		{map[string]string{"triggers": "15m,1d"}, map[string]string{
+			"event":   "DISPLAY -PT15M,AUDIO -PT5M,DISPLAY -P1D",
+			"other":   "DISPLAY -PT15M,DISPLAY -P1D",
+			"due":     "DISPLAY -PT15M,DISPLAY -P1D",
+			"undated": "",
+			"journal": "",
+		}},
+		{map[string]string{"triggers": "15m", "existing": "replace", "regex-SUMMARY": "^Vorlesung$"}, map[string]string{
+			"event": "DISPLAY -PT15M",
+			"other": "",
+		}},
+		{map[string]string{"triggers": "5m, 2024-01-05T08:00:00", "action": "audio"}, map[string]string{
+			"event":   "DISPLAY -PT15M,AUDIO -PT5M,AUDIO 20240105T080000Z",
+			"undated": "AUDIO 20240105T080000Z",
+		}},
+	}
+	for _, test := range tests {
+		cal := testCalendar(t, items)
+		test.params["timezone"] = "UTC"
+		if _, err := moduleAlarm(cal, test.params); err != nil {
+			t.Errorf("moduleAlarm(%v): unexpected error: %v", test.params, err)
+			continue
+		}
+		got := alarmTriggers(cal)
+		for id, want := range test.want {
+			if got[id] != want {
+				t.Errorf("moduleAlarm(%v): alarms of %s = %q, want %q", test.params, id, got[id], want)
+			}
+		}
+	}
+
+	// relative alarms of todos without DTSTART are related to DUE
+	cal := testCalendar(t, items)
+	if _, err := moduleAlarm(cal, map[string]string{"triggers": "1h", "action": "EMAIL", "attendee": "a@example.com, b@example.com", "summary": "Erinnerung; bald"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, component := range cal.Components {
+		todo, ok := component.(*ics.VTodo)
+		if !ok || getItemId(&todo.ComponentBase) != "due" {
+			continue
+		}
+		alarm := todo.Components[0].(*ics.VAlarm)
+		if related := alarm.GetProperty(ics.ComponentPropertyTrigger).ICalParameters[string(ics.ParameterRelated)]; strings.Join(related, ",") != "END" {
+			t.Errorf("RELATED of the todo alarm = %v, want END", related)
+		}
+		if summary := getPropertyValue(&alarm.ComponentBase, ics.ComponentPropertySummary); summary != `Erinnerung\; bald` {
+			t.Errorf("SUMMARY of the mail alarm = %q", summary)
+		}
+		if attendees := getPropertyValues(&alarm.ComponentBase, string(ics.ComponentPropertyAttendee)); strings.Join(attendees, ",") != "mailto:a@example.com,mailto:b@example.com" {
+			t.Errorf("ATTENDEE of the mail alarm = %v", attendees)
+		}
+	}
+
+	for _, params := range []map[string]string{
+		{},
+		{"triggers": "soon"},
+		{"triggers": "15m", "action": "EMAIL"},
+		{"triggers": "15m", "action": "EMAIL", "attendee": "a@example.com,kein-mail"},
+		{"triggers": "15m", "action": "PROCEDURE"},
+		{"triggers": "15m", "existing": "merge"},
+	} {
+		if _, err := moduleAlarm(testCalendar(t, items), params); err == nil {
+			t.Errorf("moduleAlarm(%v): expected an error", params)
+		}
+	}
+}
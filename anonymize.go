@@ -0,0 +1,125 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+
+	ics "github.com/arran4/golang-ical"
+	log "github.com/sirupsen/logrus"
+)
+
+// properties kept by the anonymize module by default, all others are removed.
+// These are only needed for scheduling and don't contain any details.
+var anonymizeKeepProperties = []string{"UID", "DTSTAMP", "SEQUENCE", "DTSTART", "DTEND", "DURATION", "DUE", "RRULE", "RDATE", "EXDATE",
+	"RECURRENCE-ID", "STATUS", "TRANSP", "CLASS", "SUMMARY"}
+
+// parseAnonymizeParams checks the parameters of the anonymize module and returns the properties to keep.
+func parseAnonymizeParams(params map[string]string) ([]string, error) {
+	keep := append([]string{}, anonymizeKeepProperties...)
+	if params["keep"] != "" {
+		keep = append(keep, parsePropertyList(params["keep"])...)
+	}
+	var strip []string
+	if params["strip"] != "" {
+		strip = parsePropertyList(params["strip"])
+	}
+	var properties []string
+	for _, p := range keep {
+		if !contains(strip, p) && !contains(properties, p) {
+			properties = append(properties, p)
+		}
+	}
+	switch strings.ToUpper(params["class"]) {
+	case "", string(ics.ClassificationPublic), string(ics.ClassificationPrivate), string(ics.ClassificationConfidential):
+	default:
+		return nil, fmt.Errorf("invalid class '%s', must be 'PUBLIC', 'PRIVATE' or 'CONFIDENTIAL'", params["class"])
+	}
+	switch strings.ToUpper(params["transparency"]) {
+	case "", string(ics.TransparencyOpaque), string(ics.TransparencyTransparent):
+	default:
+		return nil, fmt.Errorf("invalid transparency '%s', must be 'OPAQUE' or 'TRANSPARENT'", params["transparency"])
+	}
+	if params["hash-uid"] != "" && params["hash-uid"] != "true" && params["hash-uid"] != "false" {
+		return nil, fmt.Errorf("invalid value for 'hash-uid': %s", params["hash-uid"])
+	}
+	if params["hash-uid"] == "true" && conf.Server.Secret == "" {
+		return nil, fmt.Errorf("'hash-uid' needs a 'secret' in the server config")
+	}
+	return properties, nil
+}
+
+// hashUid returns the HMAC-SHA256 of the UID keyed with the server secret, which stays the same for every request
+func hashUid(id string) string {
+	mac := hmac.New(sha256.New, []byte(conf.Server.Secret))
+	mac.Write([]byte(id))
+	return fmt.Sprintf("%x@ical-relay", mac.Sum(nil))
+}
+
+// This module removes the details of events, todos and journal entries, so a calendar can be shared as busy times only.
+// The summary is replaced and alarms are removed. Only the properties needed for scheduling are kept (UID, DTSTAMP, SEQUENCE,
+// DTSTART, DTEND, DURATION, DUE, RRULE, RDATE, EXDATE, RECURRENCE-ID, STATUS, TRANSP, CLASS and SUMMARY), all others,
+// including X- properties, are removed.
+// Parameters:
+// - 'summary', default "Busy": the new summary of all events
+// - 'keep', optional: comma separated list of further properties to keep, e.g. "CATEGORIES"
+// - 'strip', optional: comma separated list of properties to remove, although they are kept by default, e.g. "STATUS"
+// - 'class', optional: sets CLASS to "PUBLIC", "PRIVATE" or "CONFIDENTIAL"
+// - 'transparency', optional: sets TRANSP of events to "OPAQUE" or "TRANSPARENT"
+// - 'hash-uid', default false: if "true", the UID is replaced by a hash, since UIDs may contain details, too.
+// The hash is an HMAC keyed with the secret of the server config, so known UIDs can't be looked up in the feed.
+// Modules using the UID, like edit-byid, have to run before this module.
+// - match rules, 'combine', 'after', 'before', 'period', optional: only anonymize matching events, see parseEventMatcher
+// Returns the number of events removed or added (always 0).
+func moduleAnonymize(cal *ics.Calendar, params map[string]string) (int, error) {
+	properties, err := parseAnonymizeParams(params)
+	if err != nil {
+		return 0, err
+	}
+	if params["summary"] == "" {
+		params["summary"] = "Busy"
+	}
+	matcher, err := parseEventMatcher(params)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, component := range cal.Components {
+		item := getItemBase(component)
+		if item == nil {
+			continue
+		}
+		matched, err := matcher.matches(component)
+		if err != nil {
+			log.Warnf("Skipping event: %s", err.Error())
+			continue
+		}
+		if !matched {
+			continue
+		}
+		id := getItemId(item)
+		var kept []ics.IANAProperty
+		for _, p := range item.Properties {
+			if contains(properties, strings.ToUpper(p.IANAToken)) {
+				kept = append(kept, p)
+			}
+		}
+		item.Properties = kept
+		// alarms repeat the summary or description
+		item.Components = nil
+		item.SetProperty(ics.ComponentPropertySummary, ics.ToText(params["summary"]))
+		if params["class"] != "" {
+			item.SetProperty(ics.ComponentPropertyClass, strings.ToUpper(params["class"]))
+		}
+		// only events can be transparent
+		if _, ok := component.(*ics.VEvent); ok && params["transparency"] != "" {
+			item.SetProperty(ics.ComponentPropertyTransp, strings.ToUpper(params["transparency"]))
+		}
+		if params["hash-uid"] == "true" {
+			item.SetProperty(ics.ComponentPropertyUniqueId, hashUid(id))
+		}
+		log.Debug("Anonymized " + getItemType(component) + " with id " + id + "\n")
+	}
+	return 0, nil
+}
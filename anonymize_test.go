@@ -0,0 +1,142 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"testing"
+
+	ics "github.com/arran4/golang-ical"
+)
+
+func TestModuleAnonymize(t *testing.T) {
+	cal := testCalendar(t, `BEGIN:VEVENT
+UID:event-1
+DTSTAMP:20240101T000000Z
+DTSTART:20240119T140000Z
+DTEND:20240119T170000Z
+SUMMARY:Arzttermin
+DESCRIPTION:Dr. Muster
+LOCATION:Praxis
+ORGANIZER:mailto:praxis@example.com
+X-PATIENT-ID:4711
+X-ICAL-RELAY-MERGED:praxis-termin-4711
+RRULE:FREQ=WEEKLY;COUNT=3
+BEGIN:VALARM
+ACTION:DISPLAY
+DESCRIPTION:Arzttermin
+TRIGGER:-PT15M
+END:VALARM
+END:VEVENT
+BEGIN:VTODO
+UID:todo-1
+DTSTAMP:20240101T000000Z
+DUE:20240120T100000Z
+SUMMARY:Befund abholen
+DESCRIPTION:Dr. Muster
+LOCATION:Praxis
+ATTENDEE:mailto:me@example.com
+URL:https://example.com/befund
+BEGIN:VALARM
+ACTION:DISPLAY
+DESCRIPTION:Befund abholen
+TRIGGER:-PT15M
+END:VALARM
+END:VTODO
+BEGIN:VJOURNAL
+UID:journal-1
+DTSTAMP:20240101T000000Z
+DTSTART;VALUE=DATE:20240119
+SUMMARY:Diagnose
+DESCRIPTION:Privat
+END:VJOURNAL`)
+
+	if _, err := moduleAnonymize(cal, map[string]string{"class": "private", "transparency": "transparent"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(cal.Components) != 3 {
+		t.Fatalf("anonymize changed the number of components to %d", len(cal.Components))
+	}
+	for _, component := range cal.Components {
+		item := getItemBase(component)
+		id := getItemId(item)
+		if summary := getPropertyValue(item, ics.ComponentPropertySummary); summary != "Busy" {
+			t.Errorf("%s has summary %q, want \"Busy\"", id, summary)
+		}
+		for _, p := range item.Properties {
+			if !contains(anonymizeKeepProperties, p.IANAToken) {
+				t.Errorf("%s still has %s", id, p.IANAToken)
+			}
+		}
+		if len(item.Components) != 0 {
+			t.Errorf("%s still has alarms", id)
+		}
+		if class := getPropertyValue(item, ics.ComponentPropertyClass); class != "PRIVATE" {
+			t.Errorf("%s has class %q, want PRIVATE", id, class)
+		}
+	}
+	for _, detail := range []string{"Arzttermin", "Befund", "Diagnose", "Muster", "Praxis", "praxis", "4711", "Privat", "example.com"} {
+		if strings.Contains(cal.Serialize(), detail) {
+			t.Errorf("calendar still contains %q", detail)
+		}
+	}
+	if transp := getPropertyValue(&cal.Events()[0].ComponentBase, ics.ComponentPropertyTransp); transp != "TRANSPARENT" {
+		t.Errorf("event has TRANSP %q, want TRANSPARENT", transp)
+	}
+	if transp := cal.Components[1].(*ics.VTodo).GetProperty(ics.ComponentPropertyTransp); transp != nil {
+		t.Error("todo got a TRANSP property")
+	}
+	if due := getPropertyValue(getItemBase(cal.Components[1]), ics.ComponentProperty(ics.PropertyDue)); due != "20240120T100000Z" {
+		t.Errorf("todo lost its DUE: %q", due)
+	}
+	if rrule := getPropertyValue(&cal.Events()[0].ComponentBase, ics.ComponentPropertyRrule); rrule != "FREQ=WEEKLY;COUNT=3" {
+		t.Errorf("event lost its RRULE: %q", rrule)
+	}
+
+	// keep adds properties to the default list, strip removes them from it
+	cal = testCalendar(t, "BEGIN:VEVENT\nUID:event-1\nDTSTAMP:20240101T000000Z\nDTSTART:20240119T140000Z\nSTATUS:TENTATIVE\nCATEGORIES:Arzt\nX-COLOR:red\nEND:VEVENT")
+	if _, err := moduleAnonymize(cal, map[string]string{"keep": "categories, x-color", "strip": "STATUS"}); err != nil {
+		t.Fatal(err)
+	}
+	event := &cal.Events()[0].ComponentBase
+	if getPropertyValue(event, ics.ComponentPropertyCategories) != "Arzt" || getPropertyValue(event, "X-COLOR") != "red" {
+		t.Error("properties in 'keep' were removed")
+	}
+	if event.GetProperty(ics.ComponentPropertyStatus) != nil {
+		t.Error("property in 'strip' was kept")
+	}
+}
+
+func TestAnonymizeHashUid(t *testing.T) {
+	oldConf := conf
+	defer func() { conf = oldConf }()
+	event := "BEGIN:VEVENT\nUID:event-1\nDTSTAMP:20240101T000000Z\nDTSTART:20240119T140000Z\nEND:VEVENT"
+
+	conf.Server.Secret = ""
+	if _, err := moduleAnonymize(testCalendar(t, event), map[string]string{"hash-uid": "true"}); err == nil {
+		t.Error("expected an error for hash-uid without secret")
+	}
+
+	hashed := func(secret string) string {
+		conf.Server.Secret = secret
+		cal := testCalendar(t, event)
+		if _, err := moduleAnonymize(cal, map[string]string{"hash-uid": "true"}); err != nil {
+			t.Fatal(err)
+		}
+		return cal.Events()[0].Id()
+	}
+	first := hashed("secret-1")
+	if first == "event-1" || !strings.HasSuffix(first, "@ical-relay") {
+		t.Errorf("hashed UID = %q", first)
+	}
+	if again := hashed("secret-1"); again != first {
+		t.Errorf("hashed UID changed from %q to %q", first, again)
+	}
+	// the plain SHA-256 of the UID must not be usable to find it
+	if other := hashed("secret-2"); other == first {
+		t.Errorf("hashed UID doesn't depend on the secret: %q", other)
+	}
+	if plain := fmt.Sprintf("%x@ical-relay", sha256.Sum256([]byte("event-1"))); first == plain {
+		t.Error("hashed UID is the plain SHA-256 of the UID")
+	}
+}
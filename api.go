@@ -5,8 +5,10 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"os"
 	"strconv"
 
+	ics "github.com/arran4/golang-ical"
 	"github.com/gorilla/mux"
 
 	log "github.com/sirupsen/logrus"
@@ -20,6 +22,11 @@ func checkAuthoriziation(token string, profileName string) bool {
 	}
 }
 
+// checkProfileVisibility returns true, if the profile is public or the token is allowed to administrate it
+func checkProfileVisibility(token string, profileName string) bool {
+	return conf.Profiles[profileName].Public || checkAuthoriziation(token, profileName)
+}
+
 func checkSuperAuthorization(token string) bool {
 	if contains(conf.Server.SuperTokens, token) {
 		return true
@@ -178,6 +185,11 @@ func calendarEntryApiHandler(w http.ResponseWriter, r *http.Request) {
 			module["new-description"] = entry["description"].(string)
 		}
 
+		allday, ok := entry["allday"].(bool)
+		if ok {
+			module["new-allday"] = strconv.FormatBool(allday)
+		}
+
 		conf.addModule(profileName, module)
 
 		w.WriteHeader(http.StatusOK)
@@ -247,9 +259,46 @@ func modulesApiHandler(w http.ResponseWriter, r *http.Request) {
 				fmt.Fprint(w, "Module "+module["name"]+" not allowed in low-privilege mode!\n")
 				return
 			}
+			for _, param := range lowPrivDeniedParams[module["name"]] {
+				if module[param] != "" {
+					requestLogger.Warnln("Parameter " + param + " of module " + module["name"] + " not allowed in low-privilege mode!")
+					w.WriteHeader(http.StatusUnauthorized)
+					fmt.Fprint(w, "Parameter "+param+" of module "+module["name"]+" not allowed in low-privilege mode!\n")
+					return
+				}
+			}
+			if module["upload"] != "" {
+				// invalid tables are rejected by the validator
+				owner, _, err := splitTableUpload(module["upload"])
+				if err == nil && !checkAuthoriziation(token, owner) {
+					requestLogger.Warnln("Table " + module["upload"] + " not allowed in low-privilege mode!")
+					w.WriteHeader(http.StatusUnauthorized)
+					fmt.Fprint(w, "Table "+module["upload"]+" not allowed in low-privilege mode!\n")
+					return
+				}
+			}
+			if module["name"] == "add-profile" && !checkProfileVisibility(token, module["profile"]) {
+				requestLogger.Warnln("Profile " + module["profile"] + " not visible in low-privilege mode!")
+				w.WriteHeader(http.StatusUnauthorized)
+				fmt.Fprint(w, "Profile "+module["profile"]+" not allowed in low-privilege mode!\n")
+				return
+			}
 		}
 
-		conf.addModule(profileName, module)
+		if validate, ok := moduleValidators[module["name"]]; ok {
+			if err := validate(module); err != nil {
+				requestLogger.Warnln("Invalid parameters for module " + module["name"] + ": " + err.Error())
+				http.Error(w, "Invalid parameters for module "+module["name"]+": "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		err = conf.addModule(profileName, module)
+		if err != nil {
+			requestLogger.Errorln(err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 	case http.MethodDelete:
 		id := r.URL.Query().Get("id")
 
@@ -314,3 +363,198 @@ func checkSuperAuthorizationApiHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+// conflictsApiHandler lists the overlapping events in the output of the profile.
+// The timeframe can be limited with the query parameters 'from' and 'to' (time expressions) or 'period'.
+func conflictsApiHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	requestLogger := log.WithFields(log.Fields{"client": GetIP(r), "api": r.URL.Path})
+	requestLogger.Infoln("New API-Request!")
+
+	profileName := vars["profile"]
+	profile, ok := conf.Profiles[profileName]
+	if !ok {
+		requestLogger.Infoln("Profile " + profileName + " not found!")
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, "Profile "+profileName+" not found!\n")
+		return
+	}
+
+	loc := conf.getProfileLocation(profile)
+	query := map[string]string{"from": r.URL.Query().Get("from"), "to": r.URL.Query().Get("to"), "period": r.URL.Query().Get("period")}
+	from, to, err := parseTimeframe(query, "from", "to", loc)
+	if err != nil {
+		requestLogger.Errorln(err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	includeAllDay := r.URL.Query().Get("include-allday") == "true"
+
+	calendar, err := getProfileCalendar(profile, profileName)
+	if err != nil {
+		requestLogger.Errorln(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	eventJson := func(e timedEvent) map[string]interface{} {
+		return map[string]interface{}{
+			"uid":      e.event.Id(),
+			"summary":  ics.FromText(getPropertyValue(&e.event.ComponentBase, ics.ComponentPropertySummary)),
+			"location": ics.FromText(getPropertyValue(&e.event.ComponentBase, ics.ComponentPropertyLocation)),
+			"start":    e.start.In(loc),
+			"end":      e.end.In(loc),
+		}
+	}
+	conflicts := []map[string]interface{}{}
+	for _, c := range findConflicts(calendar, loc, from, to, includeAllDay, nil) {
+		conflicts = append(conflicts, map[string]interface{}{
+			"events":        []map[string]interface{}{eventJson(c.a), eventJson(c.b)},
+			"overlap_start": c.overlapStart.In(loc),
+			"overlap_end":   c.overlapEnd.In(loc),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	conflictsJson, _ := json.Marshal(conflicts)
+	fmt.Fprint(w, string(conflictsJson)+"\n")
+}
+
+// metadataApiHandler returns the calendar metadata of the profile, or changes it with a token.
+func metadataApiHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	requestLogger := log.WithFields(log.Fields{"client": GetIP(r), "api": r.URL.Path})
+	requestLogger.Infoln("New API-Request!")
+
+	profileName := vars["profile"]
+	profile, ok := conf.Profiles[profileName]
+	if !ok {
+		requestLogger.Infoln("Profile " + profileName + " not found!")
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, "Profile "+profileName+" not found!\n")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		// the metadata is public anyway, it is part of the served calendar
+	case http.MethodPost:
+		if !checkAuthoriziation(r.Header.Get("Authorization"), profileName) {
+			requestLogger.Warnln("Authorization not successful!")
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, "Unauthorized!\n")
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		var metadata calendarMetadata
+		err := json.Unmarshal(body, &metadata)
+		if err != nil {
+			requestLogger.Errorln(err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := metadata.validate(); err != nil {
+			requestLogger.Warnln("Invalid metadata: " + err.Error())
+			http.Error(w, "Invalid metadata: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		err = conf.setProfileMetadata(profileName, metadata)
+		if err != nil {
+			requestLogger.Errorln(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		profile.Metadata = metadata
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	metadataJson, _ := json.Marshal(profile.Metadata)
+	fmt.Fprint(w, string(metadataJson)+"\n")
+}
+
+// tablesApiHandler lists, returns, uploads or deletes the lookup tables of a profile, which are used by the map module.
+func tablesApiHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	requestLogger := log.WithFields(log.Fields{"client": GetIP(r), "api": r.URL.Path})
+	requestLogger.Infoln("New API-Request!")
+
+	profileName := vars["profile"]
+	if !conf.profileExists(profileName) {
+		requestLogger.Infoln("Profile " + profileName + " not found!")
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, "Profile "+profileName+" not found!\n")
+		return
+	}
+
+	if !checkAuthoriziation(r.Header.Get("Authorization"), profileName) {
+		requestLogger.Warnln("Authorization not successful!")
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, "Unauthorized!\n")
+		return
+	}
+
+	name, ok := vars["table"]
+	if !ok {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		tables, err := listTables(profileName)
+		if err != nil {
+			requestLogger.Errorln(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		tablesJson, _ := json.Marshal(tables)
+		fmt.Fprint(w, string(tablesJson)+"\n")
+		return
+	}
+	if !tableNameRegex.MatchString(name) {
+		requestLogger.Warnln("Invalid table name " + name)
+		http.Error(w, "Invalid table name "+name+", must end in .csv, .yml or .yaml", http.StatusBadRequest)
+		return
+	}
+	path := getTableDir(profileName) + name
+
+	switch r.Method {
+	case http.MethodGet:
+		data, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, "Table "+name+" not found!\n")
+			return
+		} else if err != nil {
+			requestLogger.Errorln(err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write(data)
+	case http.MethodPost, http.MethodPut:
+		data, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxTableSize))
+		if err != nil {
+			requestLogger.Errorln(err)
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err := saveTable(profileName, name, data); err != nil {
+			requestLogger.Warnln("Invalid table " + name + ": " + err.Error())
+			http.Error(w, "Invalid table "+name+": "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		requestLogger.Infoln("Saved table " + name)
+		fmt.Fprint(w, "Saved table "+profileName+"/"+name+"\n")
+	case http.MethodDelete:
+		if err := os.Remove(path); err != nil {
+			requestLogger.Errorln(err)
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
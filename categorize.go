@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	ics "github.com/arran4/golang-ical"
+	log "github.com/sirupsen/logrus"
+)
+
+// COLOR values are CSS3 color names (RFC 7986), e.g. "crimson"
+var colorNameRegex = regexp.MustCompile(`^[a-zA-Z]+$`)
+
+// parseCategorizeParams checks the parameters of the categorize module and returns the categories to set.
+func parseCategorizeParams(params map[string]string) ([]string, error) {
+	var categories []string
+	for _, c := range strings.Split(params["category"], ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			categories = append(categories, c)
+		}
+	}
+	if len(categories) == 0 && params["color"] == "" {
+		return nil, fmt.Errorf("missing mandatory Parameter 'category' or 'color'")
+	}
+	if params["color"] != "" && !colorNameRegex.MatchString(params["color"]) {
+		return nil, fmt.Errorf("invalid color '%s', must be a CSS color name like 'crimson'", params["color"])
+	}
+	if params["replace"] != "" && params["replace"] != "true" && params["replace"] != "false" {
+		return nil, fmt.Errorf("invalid value for 'replace': %s", params["replace"])
+	}
+	return categories, nil
+}
+
+// This module sets CATEGORIES and COLOR (RFC 7986) of events, so clients can color them.
+// Parameters:
+// - 'category', optional: comma separated list of categories to add
+// - 'color', optional: CSS3 color name, e.g. "crimson". Either 'category' or 'color' is mandatory.
+// - 'replace', default false: if "true", existing categories are removed first
+// - match rules, 'combine', 'after', 'before', 'period', optional: only categorize matching events, see parseEventMatcher
+// Returns the number of events removed or added (always 0).
+func moduleCategorize(cal *ics.Calendar, params map[string]string) (int, error) {
+	categories, err := parseCategorizeParams(params)
+	if err != nil {
+		return 0, err
+	}
+	matcher, err := parseEventMatcher(params)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, component := range cal.Components {
+		switch component.(type) {
+		case *ics.VEvent, *ics.VTodo, *ics.VJournal:
+			item := getItemBase(component)
+			matched, err := matcher.matches(component)
+			if err != nil {
+				log.Warnf("Skipping event: %s", err.Error())
+				continue
+			}
+			if !matched {
+				continue
+			}
+			if params["replace"] == "true" {
+				removePropertyByName(item, ics.ComponentPropertyCategories)
+			}
+			for _, c := range categories {
+				addCategory(item, c)
+			}
+			if params["color"] != "" {
+				item.SetProperty(ics.ComponentPropertyColor, strings.ToLower(params["color"]))
+			}
+			log.Debug("Categorized event with id " + getItemId(item) + "\n")
+		}
+	}
+	return 0, nil
+}
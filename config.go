@@ -15,11 +15,22 @@ import (
 // STRUCTS
 
 type profile struct {
+	Extends       string              `yaml:"extends,omitempty"`
 	Source        string              `yaml:"source"`
 	Public        bool                `yaml:"public"`
-	ImmutablePast bool                `yaml:"immutable-past,omitempty"`
+	ImmutablePast *bool               `yaml:"immutable-past,omitempty"`
+	Timezone      string              `yaml:"timezone,omitempty"`
 	Tokens        []string            `yaml:"admin-tokens"`
 	Modules       []map[string]string `yaml:"modules,omitempty"`
+	Metadata      calendarMetadata    `yaml:"metadata,omitempty"`
+}
+
+// calendarMetadata is written to the calendar properties of the served feed (RFC 7986)
+type calendarMetadata struct {
+	Name            string `yaml:"name,omitempty" json:"name"`
+	Description     string `yaml:"description,omitempty" json:"description"`
+	Color           string `yaml:"color,omitempty" json:"color"`
+	RefreshInterval string `yaml:"refresh-interval,omitempty" json:"refresh-interval"`
 }
 
 type mailConfig struct {
@@ -38,14 +49,22 @@ type serverConfig struct {
 	TemplatePath  string     `yaml:"templatepath"`
 	Imprint       string     `yaml:"imprintlink"`
 	PrivacyPolicy string     `yaml:"privacypolicylink"`
+	Timezone      string     `yaml:"timezone,omitempty"`
 	Mail          mailConfig `yaml:"mail,omitempty"`
 	SuperTokens   []string   `yaml:"super-tokens,omitempty"`
+	Secret        string     `yaml:"secret,omitempty"`
 }
 
 type notifier struct {
 	Source     string   `yaml:"source"`
 	Interval   string   `yaml:"interval"`
 	Recipients []string `yaml:"recipients"`
+	Timezone   string   `yaml:"timezone,omitempty"`
+}
+
+type period struct {
+	From  string `yaml:"from"`
+	Until string `yaml:"until"`
 }
 
 // Config represents configuration for the application
@@ -53,6 +72,7 @@ type Config struct {
 	Server    serverConfig        `yaml:"server"`
 	Profiles  map[string]profile  `yaml:"profiles,omitempty"`
 	Notifiers map[string]notifier `yaml:"notifiers,omitempty"`
+	Periods   map[string]period   `yaml:"periods,omitempty"`
 }
 
 // CONFIG MANAGEMENT FUNCTIONS
@@ -93,6 +113,60 @@ func ParseConfig(path string) (Config, error) {
 		tmpConfig.Server.TemplatePath += "/"
 	}
 
+	// timezones
+	if _, err := time.LoadLocation(tmpConfig.Server.Timezone); err != nil {
+		log.Fatalf("Invalid server timezone '%s': %v", tmpConfig.Server.Timezone, err)
+		return tmpConfig, err
+	}
+	for name, p := range tmpConfig.Profiles {
+		if _, err := time.LoadLocation(p.Timezone); err != nil {
+			log.Fatalf("Invalid timezone '%s' in profile %s: %v", p.Timezone, name, err)
+			return tmpConfig, err
+		}
+	}
+	for name, p := range tmpConfig.Profiles {
+		if err := p.Metadata.validate(); err != nil {
+			log.Fatalf("Invalid metadata in profile %s: %v", name, err)
+			return tmpConfig, err
+		}
+		if _, err := tmpConfig.resolveProfile(p); err != nil {
+			log.Fatalf("Invalid profile %s: %v", name, err)
+			return tmpConfig, err
+		}
+		if err := tmpConfig.checkIncludedProfiles(name, nil); err != nil {
+			log.Fatalf("Invalid profile %s: %v", name, err)
+			return tmpConfig, err
+		}
+	}
+	// relative expirations like "now+1w" would never expire, if they were evaluated on every cleanup.
+	// They are only resolved in memory and written to the file with the next change of the config.
+	for name, p := range tmpConfig.Profiles {
+		for i, m := range p.Modules {
+			if m["expires"] == "" {
+				continue
+			}
+			exp, err := resolveExpiry(m["expires"], tmpConfig.getProfileLocation(p))
+			if err != nil {
+				log.Fatalf("Invalid expiration of module at position %d in profile %s: %v", i+1, name, err)
+				return tmpConfig, err
+			}
+			m["expires"] = exp
+		}
+	}
+	for name, n := range tmpConfig.Notifiers {
+		if _, err := time.LoadLocation(n.Timezone); err != nil {
+			log.Fatalf("Invalid timezone '%s' in notifier %s: %v", n.Timezone, name, err)
+			return tmpConfig, err
+		}
+	}
+
+	for name, p := range tmpConfig.Periods {
+		if _, _, err := p.getTimeframe(time.UTC); err != nil {
+			log.Fatalf("Invalid period %s: %v", name, err)
+			return tmpConfig, err
+		}
+	}
+
 	if !directoryExists(tmpConfig.Server.StoragePath + "notifystore/") {
 		log.Info("Creating notifystore directory")
 		err = os.MkdirAll(tmpConfig.Server.StoragePath+"notifystore/", 0750)
@@ -101,6 +175,14 @@ func ParseConfig(path string) (Config, error) {
 			return tmpConfig, err
 		}
 	}
+	if !directoryExists(tmpConfig.Server.StoragePath + "tablestore/") {
+		log.Info("Creating tablestore directory")
+		err = os.MkdirAll(tmpConfig.Server.StoragePath+"tablestore/", 0750)
+		if err != nil {
+			log.Fatalf("Error creating tablestore: %v", err)
+			return tmpConfig, err
+		}
+	}
 	if !directoryExists(tmpConfig.Server.StoragePath + "calstore/") {
 		log.Info("Creating calstore directory")
 		err = os.MkdirAll(tmpConfig.Server.StoragePath+"calstore/", 0750)
@@ -133,6 +215,52 @@ func (c Config) saveConfig(path string) error {
 	return ioutil.WriteFile(path, d, 0600)
 }
 
+// returns the default timezone of the server. If none is configured, the local time of the machine is used.
+func (c Config) getServerLocation() *time.Location {
+	if c.Server.Timezone == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(c.Server.Timezone)
+	if err != nil {
+		log.Errorf("Invalid server timezone '%s', using local time: %v", c.Server.Timezone, err)
+		return time.Local
+	}
+	return loc
+}
+
+// returns the timezone of the profile, or the server timezone if none is set. The timezone may be inherited, see resolveProfile.
+func (c Config) getProfileLocation(p profile) *time.Location {
+	if resolved, err := c.resolveProfile(p); err == nil {
+		p = resolved
+	}
+	if p.Timezone == "" {
+		return c.getServerLocation()
+	}
+	loc, err := time.LoadLocation(p.Timezone)
+	if err != nil {
+		log.Errorf("Invalid profile timezone '%s', using server timezone: %v", p.Timezone, err)
+		return c.getServerLocation()
+	}
+	return loc
+}
+
+// returns the timezone of the notifier. If none is set, the timezone of the profile with the same name is used,
+// or the server timezone if there is no such profile.
+func (c Config) getNotifierLocation(name string, n notifier) *time.Location {
+	if n.Timezone == "" {
+		if p, ok := c.Profiles[name]; ok {
+			return c.getProfileLocation(p)
+		}
+		return c.getServerLocation()
+	}
+	loc, err := time.LoadLocation(n.Timezone)
+	if err != nil {
+		log.Errorf("Invalid notifier timezone '%s', using server timezone: %v", n.Timezone, err)
+		return c.getServerLocation()
+	}
+	return loc
+}
+
 // CONFIG EDITING FUNCTIONS
 
 func (c Config) getPublicCalendars() []string {
@@ -150,6 +278,11 @@ func (c Config) profileExists(name string) bool {
 	return ok
 }
 
+func (c Config) periodExists(name string) bool {
+	_, ok := c.Periods[name]
+	return ok
+}
+
 func (c Config) notifierExists(name string) bool {
 	_, ok := c.Notifiers[name]
 	return ok
@@ -194,23 +327,179 @@ func (c Config) addModule(profile string, module map[string]string) error {
 	if !c.profileExists(profile) {
 		return fmt.Errorf("profile " + profile + " does not exist")
 	}
+	if module["expires"] != "" {
+		// relative expressions like "now+2w" are resolved when the module is added
+		exp, err := resolveExpiry(module["expires"], c.getProfileLocation(c.Profiles[profile]))
+		if err != nil {
+			return fmt.Errorf("invalid expiration: %s", err.Error())
+		}
+		module["expires"] = exp
+	}
 	p := c.Profiles[profile]
+	old := p
 	p.Modules = append(c.Profiles[profile].Modules, module)
 	c.Profiles[profile] = p
+	if err := c.checkIncludedProfiles(profile, nil); err != nil {
+		c.Profiles[profile] = old
+		return err
+	}
+	return c.saveConfig(configPath)
+}
+
+// resolveProfile returns the profile with the source, timezone, immutable past, metadata and modules inherited from the
+// profile it extends. Source, timezone, immutable past and each metadata field of the profile override the inherited ones. Its modules are added after the
+// inherited modules, unless they have the same 'module-id' as an inherited module, which they replace.
+// Modules with 'disabled: true' are skipped, so an inherited module is disabled by replacing it with a disabled one.
+// The returned profile doesn't extend any profile, so it can be resolved again without changes.
+func (c Config) resolveProfile(p profile) (profile, error) {
+	var chain []string
+	for p.Extends != "" {
+		if contains(chain, p.Extends) {
+			return p, fmt.Errorf("profile '%s' extends itself: %s", p.Extends, strings.Join(append(chain, p.Extends), " -> "))
+		}
+		chain = append(chain, p.Extends)
+		base, ok := c.Profiles[p.Extends]
+		if !ok {
+			return p, fmt.Errorf("extended profile '%s' doesn't exist", p.Extends)
+		}
+		p = inheritProfile(base, p)
+	}
+	return p, nil
+}
+
+// inheritProfile merges the profile with the profile it extends, see resolveProfile. Access settings aren't inherited.
+// The result extends the profile base extends.
+func inheritProfile(base profile, p profile) profile {
+	p.Extends = base.Extends
+	if p.Source == "" {
+		p.Source = base.Source
+	}
+	if p.Timezone == "" {
+		p.Timezone = base.Timezone
+	}
+	// only profiles without the setting inherit it, so 'immutable-past: false' turns it off
+	if p.ImmutablePast == nil {
+		p.ImmutablePast = base.ImmutablePast
+	}
+	if p.Metadata.Name == "" {
+		p.Metadata.Name = base.Metadata.Name
+	}
+	if p.Metadata.Description == "" {
+		p.Metadata.Description = base.Metadata.Description
+	}
+	if p.Metadata.Color == "" {
+		p.Metadata.Color = base.Metadata.Color
+	}
+	if p.Metadata.RefreshInterval == "" {
+		p.Metadata.RefreshInterval = base.Metadata.RefreshInterval
+	}
+	// copy the modules, so the profiles in the config aren't changed
+	modules := append([]map[string]string{}, base.Modules...)
+	for _, module := range p.Modules {
+		overridden := false
+		if module["module-id"] != "" {
+			for i, inherited := range modules {
+				if inherited["module-id"] == module["module-id"] {
+					modules[i] = module
+					overridden = true
+					break
+				}
+			}
+		}
+		if !overridden {
+			modules = append(modules, module)
+		}
+	}
+	p.Modules = modules
+	return p
+}
+
+// hasImmutablePast returns true, if the profile keeps past events unchanged, see the immutable past in buildProfileCalendar.
+// The setting may be inherited, so the profile has to be resolved, see resolveProfile.
+func (p profile) hasImmutablePast() bool {
+	return p.ImmutablePast != nil && *p.ImmutablePast
+}
+
+// getIncludedProfiles returns the names of the profiles used by the source ("profile:<name>") and the add-profile modules
+func (p profile) getIncludedProfiles() []string {
+	var names []string
+	if strings.HasPrefix(p.Source, profileSourcePrefix) {
+		names = append(names, strings.TrimPrefix(p.Source, profileSourcePrefix))
+	}
+	for _, module := range p.Modules {
+		if module["name"] == "add-profile" {
+			names = append(names, module["profile"])
+		}
+	}
+	return names
+}
+
+// checkIncludedProfiles checks that all profiles included by the profile exist and that it doesn't include itself.
+// chain contains the profiles which include this one.
+func (c Config) checkIncludedProfiles(name string, chain []string) error {
+	if contains(chain, name) {
+		return fmt.Errorf("profile '%s' includes itself: %s", name, strings.Join(append(chain, name), " -> "))
+	}
+	chain = append(append([]string{}, chain...), name)
+	p, err := c.resolveProfile(c.Profiles[name])
+	if err != nil {
+		return err
+	}
+	for _, included := range p.getIncludedProfiles() {
+		if !c.profileExists(included) {
+			return fmt.Errorf("included profile '%s' doesn't exist", included)
+		}
+		if err := c.checkIncludedProfiles(included, chain); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c Config) setProfileMetadata(profile string, metadata calendarMetadata) error {
+	if !c.profileExists(profile) {
+		return fmt.Errorf("profile " + profile + " does not exist")
+	}
+	if err := metadata.validate(); err != nil {
+		return err
+	}
+	p := c.Profiles[profile]
+	p.Metadata = metadata
+	c.Profiles[profile] = p
 	return c.saveConfig(configPath)
 }
 
 func (c Config) removeModuleFromProfile(profile string, index int) {
 	log.Info("Removing expired module at position " + fmt.Sprint(index+1) + " from profile " + profile)
-	removeFromMapString(c.Profiles[profile].Modules, index)
+	p := c.Profiles[profile]
+	p.Modules = removeFromMapString(p.Modules, index)
+	c.Profiles[profile] = p
 	c.saveConfig(configPath)
 }
 
+// resolveExpiry returns the expiration of a module as RFC3339 time, so relative expressions are evaluated only once
+func resolveExpiry(expires string, loc *time.Location) (string, error) {
+	if _, err := time.Parse(time.RFC3339, expires); err == nil {
+		return expires, nil
+	}
+	exp, err := parseTimeExpression(expires, loc)
+	if err != nil {
+		return "", err
+	}
+	return exp.Format(time.RFC3339), nil
+}
+
 func (c Config) RunCleanup() {
 	for p := range c.Profiles {
-		for i, m := range c.Profiles[p].Modules {
+		// iterate backwards, so removing a module doesn't shift the ones not yet checked
+		for i := len(c.Profiles[p].Modules) - 1; i >= 0; i-- {
+			m := c.Profiles[p].Modules[i]
 			if m["expires"] != "" {
-				exp, _ := time.Parse(time.RFC3339, m["expiration"])
+				exp, err := parseTimeExpression(m["expires"], c.getProfileLocation(c.Profiles[p]))
+				if err != nil {
+					log.Errorf("Invalid expiration of module at position %d in profile %s: %v", i+1, p, err)
+					continue
+				}
 				if time.Now().After(exp) {
 					c.removeModuleFromProfile(p, i)
 				}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestResolveExpiry(t *testing.T) {
+	// absolute times are kept
+	got, err := resolveExpiry("2024-03-01T10:00:00Z", time.UTC)
+	if err != nil || got != "2024-03-01T10:00:00Z" {
+		t.Errorf("resolveExpiry of RFC3339 time = %q, %v", got, err)
+	}
+	got, err = resolveExpiry("2024-03-01", time.UTC)
+	if err != nil || got != "2024-03-01T00:00:00Z" {
+		t.Errorf("resolveExpiry of date = %q, %v", got, err)
+	}
+
+	// relative expressions are resolved once, so resolving again doesn't move them
+	before := time.Now()
+	got, err = resolveExpiry("now+1w", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp, err := time.Parse(time.RFC3339, got)
+	if err != nil {
+		t.Fatalf("resolveExpiry returned no RFC3339 time: %q", got)
+	}
+	if exp.Before(before.Add(7*24*time.Hour).Truncate(time.Second)) || exp.After(time.Now().Add(7*24*time.Hour)) {
+		t.Errorf("resolveExpiry(\"now+1w\") = %v, want about one week from now", exp)
+	}
+	if again, err := resolveExpiry(got, time.UTC); err != nil || again != got {
+		t.Errorf("resolving %q again = %q, %v", got, again, err)
+	}
+
+	if _, err := resolveExpiry("soon", time.UTC); err == nil {
+		t.Error("expected an error for an invalid expiration")
+	}
+}
+
+func TestParseConfigDoesntWrite(t *testing.T) {
+	dir := t.TempDir()
+	path := dir + "/config.yml"
+	data := "server:\n  storagepath: " + dir + "\nprofiles:\n  relay:\n    source: \"\"\n    modules:\n    - name: delete-byid\n      id: \"1\"\n      expires: now+1w\n"
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	c, err := ParseConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written, err := os.ReadFile(path); err != nil || string(written) != data {
+		t.Errorf("ParseConfig changed the config file:\n%s", written)
+	}
+	// the expiration is resolved in memory
+	exp, err := time.Parse(time.RFC3339, c.Profiles["relay"].Modules[0]["expires"])
+	if err != nil || exp.Before(time.Now().Add(6*24*time.Hour)) {
+		t.Errorf("relative expiration was resolved to %q", c.Profiles["relay"].Modules[0]["expires"])
+	}
+}
+
+func TestInheritImmutablePast(t *testing.T) {
+	yes, no := true, false
+	c := Config{Profiles: map[string]profile{
+		"base":     {Source: "https://example.com/a.ics", ImmutablePast: &yes},
+		"child":    {Extends: "base"},
+		"grand":    {Extends: "child"},
+		"disabled": {Extends: "base", ImmutablePast: &no},
+		"plain":    {Source: "https://example.com/b.ics"},
+	}}
+	for name, want := range map[string]bool{"base": true, "child": true, "grand": true, "disabled": false, "plain": false} {
+		p, err := c.resolveProfile(c.Profiles[name])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := p.hasImmutablePast(); got != want {
+			t.Errorf("profile %s has immutable past %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestResolveProfile(t *testing.T) {
+	c := Config{Profiles: map[string]profile{
+		"base": {
+			Source:   "https://example.com/base.ics",
+			Public:   true,
+			Timezone: "Europe/Berlin",
+			Tokens:   []string{"base-token"},
+			Metadata: calendarMetadata{Name: "Basis", Color: "crimson", RefreshInterval: "1h"},
+			Modules: []map[string]string{
+				{"name": "delete-bysummary-regex", "regex": "^Sport$", "module-id": "sport"},
+				{"name": "delete-byid", "id": "1"},
+				{"name": "add-reminder", "time": "15M", "module-id": "reminder"},
+			},
+		},
+		"child": {
+			Extends:  "base",
+			Timezone: "America/New_York",
+			Metadata: calendarMetadata{Name: "Kind"},
+			Modules: []map[string]string{
+				// replaces the inherited module at its position
+				{"name": "delete-bysummary-regex", "regex": "^Mensa$", "module-id": "sport"},
+				{"name": "add-reminder", "module-id": "reminder", "disabled": "true"},
+				{"name": "delete-byid", "id": "2"},
+			},
+		},
+		"grandchild": {Extends: "child", Source: "https://example.com/grandchild.ics"},
+		"loop-a":     {Extends: "loop-b"},
+		"loop-b":     {Extends: "loop-a"},
+		"orphan":     {Extends: "nowhere"},
+	}}
+
+	p, err := c.resolveProfile(c.Profiles["grandchild"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Extends != "" || p.Source != "https://example.com/grandchild.ics" || p.Timezone != "America/New_York" {
+		t.Errorf("resolved profile has extends %q, source %q and timezone %q", p.Extends, p.Source, p.Timezone)
+	}
+	if p.Metadata != (calendarMetadata{Name: "Kind", Color: "crimson", RefreshInterval: "1h"}) {
+		t.Errorf("resolved metadata = %+v", p.Metadata)
+	}
+	// access settings aren't inherited
+	if p.Public || len(p.Tokens) != 0 {
+		t.Errorf("resolved profile is public %v with tokens %v", p.Public, p.Tokens)
+	}
+	var modules []string
+	for _, m := range p.Modules {
+		modules = append(modules, m["name"]+" "+m["regex"]+m["id"]+m["disabled"])
+	}
+	want := []string{"delete-bysummary-regex ^Mensa$", "delete-byid 1", "add-reminder true", "delete-byid 2"}
+	if strings.Join(modules, "\n") != strings.Join(want, "\n") {
+		t.Errorf("resolved modules =\n%s\nwant\n%s", strings.Join(modules, "\n"), strings.Join(want, "\n"))
+	}
+	// the base profile in the config isn't changed
+	if c.Profiles["base"].Modules[0]["regex"] != "^Sport$" || len(c.Profiles["base"].Modules) != 3 {
+		t.Errorf("base profile was changed: %v", c.Profiles["base"].Modules)
+	}
+
+	for name, want := range map[string]string{
+		"loop-a": "profile 'loop-b' extends itself: loop-b -> loop-a -> loop-b",
+		"orphan": "extended profile 'nowhere' doesn't exist",
+	} {
+		if _, err := c.resolveProfile(c.Profiles[name]); err == nil || err.Error() != want {
+			t.Errorf("resolveProfile(%s) = %v, want %q", name, err, want)
+		}
+	}
+}
+
+func TestBuildProfileCalendarDisabledModule(t *testing.T) {
+	oldConf := conf
+	defer func() { conf = oldConf }()
+	conf = Config{Profiles: map[string]profile{
+		// the inherited module would fail without its parameter
+		"base":  {Modules: []map[string]string{{"name": "delete-byid", "module-id": "broken"}}},
+		"child": {Extends: "base", Modules: []map[string]string{{"name": "delete-byid", "module-id": "broken", "disabled": "true"}}},
+	}}
+	if _, err := getProfileCalendar(conf.Profiles["base"], "base"); err == nil {
+		t.Error("expected an error of the module in the base profile")
+	}
+	if _, err := getProfileCalendar(conf.Profiles["child"], "child"); err != nil {
+		t.Errorf("disabled module was run: %v", err)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	ics "github.com/arran4/golang-ical"
+	log "github.com/sirupsen/logrus"
+)
+
+type timedEvent struct {
+	event *ics.VEvent
+	start time.Time
+	end   time.Time
+}
+
+type conflict struct {
+	a, b         timedEvent
+	overlapStart time.Time
+	overlapEnd   time.Time
+}
+
+// findConflicts returns all pairs of overlapping events, which end after from and start before until.
+// Cancelled and transparent (free) events never conflict. All-day events are only considered, if includeAllDay is set.
+// If matcher is not nil, only matching events are considered.
+func findConflicts(cal *ics.Calendar, loc *time.Location, from time.Time, until time.Time, includeAllDay bool, matcher *eventMatcher) []conflict {
+	var events []timedEvent
+	for _, event := range cal.Events() {
+		if getPropertyValue(&event.ComponentBase, ics.ComponentPropertyStatus) == string(ics.ObjectStatusCancelled) ||
+			getPropertyValue(&event.ComponentBase, ics.ComponentPropertyTransp) == string(ics.TransparencyTransparent) {
+			continue
+		}
+		if matcher != nil {
+			matched, err := matcher.matches(event)
+			if err != nil || !matched {
+				continue
+			}
+		}
+		start, end, allDay, err := getEventTimes(event, loc)
+		if err != nil {
+			log.Warnf("Skipping event: %s", err.Error())
+			continue
+		}
+		if (allDay && !includeAllDay) || !end.After(from) || !start.Before(until) {
+			continue
+		}
+		events = append(events, timedEvent{event: event, start: start, end: end})
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].start.Before(events[j].start) })
+
+	// sweep over the events by start, comparing each with the events that haven't ended yet
+	var conflicts []conflict
+	var active []timedEvent
+	for _, e := range events {
+		var stillActive []timedEvent
+		for _, a := range active {
+			if a.end.After(e.start) {
+				stillActive = append(stillActive, a)
+			}
+		}
+		active = stillActive
+		for _, a := range active {
+			if a.start.Before(e.end) {
+				overlapEnd := a.end
+				if e.end.Before(overlapEnd) {
+					overlapEnd = e.end
+				}
+				conflicts = append(conflicts, conflict{a: a, b: e, overlapStart: e.start, overlapEnd: overlapEnd})
+			}
+		}
+		active = append(active, e)
+	}
+	return conflicts
+}
+
+// This module flags events overlapping with other events, by prefixing their summary and adding a category.
+// Cancelled and transparent (free) events don't conflict.
+// Parameters:
+// - 'prefix', default "⚠ ": text prepended to the summary of conflicting events
+// - 'category', default "Conflict": category added to conflicting events, "none" to not add one
+// - 'include-allday', default false: if "true", all-day events can conflict, too
+// - match rules, 'combine', 'after', 'before', 'period', optional: only check matching events, see parseEventMatcher
+// Returns the number of events removed or added (always 0).
+func moduleConflicts(cal *ics.Calendar, params map[string]string) (int, error) {
+	if params["prefix"] == "" {
+		params["prefix"] = "⚠ "
+	}
+	if params["category"] == "" {
+		params["category"] = "Conflict"
+	}
+	if params["include-allday"] != "" && params["include-allday"] != "true" && params["include-allday"] != "false" {
+		return 0, fmt.Errorf("invalid value for 'include-allday': %s", params["include-allday"])
+	}
+	loc, err := getParamLocation(params)
+	if err != nil {
+		return 0, err
+	}
+	matcher, err := parseEventMatcher(params)
+	if err != nil {
+		return 0, err
+	}
+
+	flagged := make(map[*ics.VEvent]bool)
+	for _, c := range findConflicts(cal, loc, time.Time{}, maxTime, params["include-allday"] == "true", matcher) {
+		for _, e := range []*ics.VEvent{c.a.event, c.b.event} {
+			if flagged[e] {
+				continue
+			}
+			flagged[e] = true
+			e.SetProperty(ics.ComponentPropertySummary, ics.ToText(params["prefix"])+getPropertyValue(&e.ComponentBase, ics.ComponentPropertySummary))
+			if params["category"] != "none" {
+				addCategory(&e.ComponentBase, params["category"])
+			}
+			log.Debug("Flagged conflicting event with id " + e.Id() + "\n")
+		}
+	}
+	return 0, nil
+}
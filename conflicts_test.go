@@ -0,0 +1,101 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	ics "github.com/arran4/golang-ical"
+)
+
+// conflictPairs returns the conflicts as sorted "uid-uid" pairs
+func conflictPairs(conflicts []conflict) string {
+	var pairs []string
+	for _, c := range conflicts {
+		pairs = append(pairs, c.a.event.Id()+"-"+c.b.event.Id())
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func TestFindConflicts(t *testing.T) {
+	cal := testCalendar(t, strings.Join([]string{
+		testEvent("a", "A", "20240105T100000", "20240105T120000"),
+		// touches a, doesn't overlap
+		testEvent("b", "B", "20240105T120000", "20240105T130000"),
+		// nested in a
+		testEvent("c", "C", "20240105T103000", "20240105T110000"),
+		// overlaps a and c by one minute
+		testEvent("d", "D", "20240105T105900", "20240105T113000"),
+		// cancelled and free events never conflict
+		testEvent("cancelled", "X", "20240105T100000", "20240105T120000", "STATUS:CANCELLED"),
+		testEvent("free", "Y", "20240105T100000", "20240105T120000", "TRANSP:TRANSPARENT"),
+		"BEGIN:VEVENT\nUID:day\nDTSTAMP:20240101T000000Z\nDTSTART;VALUE=DATE:20240105\nDTEND;VALUE=DATE:20240106\nSUMMARY:Day\nEND:VEVENT",
+		// the next day
+		testEvent("e", "E", "20240106T100000", "20240106T110000"),
+		testEvent("f", "F", "20240106T103000", "20240106T113000"),
+	}, "\n"))
+
+	conflicts := findConflicts(cal, time.UTC, time.Time{}, maxTime, false, nil)
+	if got := conflictPairs(conflicts); got != "a-c,a-d,c-d,e-f" {
+		t.Errorf("conflicts = %s", got)
+	}
+	for _, c := range conflicts {
+		if c.a.event.Id() == "c" && c.b.event.Id() == "d" {
+			if c.overlapStart.Format("1504") != "1059" || c.overlapEnd.Format("1504") != "1100" {
+				t.Errorf("overlap of c and d is %v to %v", c.overlapStart, c.overlapEnd)
+			}
+		}
+	}
+
+	// all-day events conflict with all events of their day
+	if got := conflictPairs(findConflicts(cal, time.UTC, time.Time{}, maxTime, true, nil)); got != "a-c,a-d,c-d,day-a,day-b,day-c,day-d,e-f" {
+		t.Errorf("conflicts with all-day events = %s", got)
+	}
+
+	// the timeframe includes events ending after from and starting before until
+	from := time.Date(2024, 1, 5, 12, 0, 0, 0, time.UTC)
+	until := time.Date(2024, 1, 6, 10, 30, 0, 0, time.UTC)
+	if got := conflictPairs(findConflicts(cal, time.UTC, from, until, false, nil)); got != "" {
+		t.Errorf("conflicts in timeframe = %s, want none", got)
+	}
+	until = until.Add(time.Second)
+	if got := conflictPairs(findConflicts(cal, time.UTC, from, until, false, nil)); got != "e-f" {
+		t.Errorf("conflicts in timeframe = %s, want e-f", got)
+	}
+
+	matcher, err := parseEventMatcher(map[string]string{"regex-SUMMARY": "^[ACE]$"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := conflictPairs(findConflicts(cal, time.UTC, time.Time{}, maxTime, false, matcher)); got != "a-c" {
+		t.Errorf("conflicts of matching events = %s, want a-c", got)
+	}
+}
+
+func TestModuleConflicts(t *testing.T) {
+	cal := testCalendar(t, strings.Join([]string{
+		testEvent("a", "A", "20240105T100000", "20240105T120000"),
+		testEvent("b", "B", "20240105T110000", "20240105T130000"),
+		testEvent("c", "C\\, D", "20240105T113000", "20240105T140000"),
+		testEvent("d", "D", "20240105T140000", "20240105T150000"),
+	}, "\n"))
+	if _, err := moduleConflicts(cal, map[string]string{"prefix": "Konflikt; ", "timezone": "UTC"}); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"a": `Konflikt\; A`, "b": `Konflikt\; B`, "c": `Konflikt\; C\, D`, "d": "D"}
+	for _, event := range cal.Events() {
+		// events conflicting with several events are only flagged once
+		if summary := getPropertyValue(&event.ComponentBase, ics.ComponentPropertySummary); summary != want[event.Id()] {
+			t.Errorf("summary of %s = %q, want %q", event.Id(), summary, want[event.Id()])
+		}
+		if categories := strings.Join(getCategories(&event.ComponentBase), ","); (categories == "Conflict") != (event.Id() != "d") {
+			t.Errorf("categories of %s = %q", event.Id(), categories)
+		}
+	}
+
+	if _, err := moduleConflicts(cal, map[string]string{"include-allday": "yes"}); err == nil {
+		t.Error("expected an error for an invalid include-allday")
+	}
+}
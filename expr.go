@@ -0,0 +1,961 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	ics "github.com/arran4/golang-ical"
+	log "github.com/sirupsen/logrus"
+)
+
+// The expression language used by the 'expression' module.
+// Expressions only read the event they are evaluated for and can't loop, so they are safe to be written by low-privilege users.
+//
+// Values are strings, numbers, booleans, durations (e.g. 2h, 30m, 1h30m, 2d), times and lists of strings.
+// Operators, by precedence: '||' (or), '&&' (and), '!' (not), comparisons ('==', '!=', '=~', '!~', '<', '<=', '>', '>='), '+' and '-'.
+// Times can be compared with strings, which are parsed as time expressions (e.g. start > "2024-01-01" or start < "now+1w").
+// See exprVariables and exprFunctions for the available variables and functions.
+
+// limits of expressions, to keep them cheap to evaluate
+const (
+	exprMaxLength = 2000
+	exprMaxDepth  = 50
+)
+
+type exprEnv struct {
+	item     ics.Component // event, todo or journal entry
+	itemBase *ics.ComponentBase
+	loc      *time.Location
+}
+
+type exprNode interface {
+	eval(env *exprEnv) (interface{}, error)
+}
+
+// variables available in expressions
+var exprVariables = map[string]func(env *exprEnv) (interface{}, error){
+	"summary":     exprPropertyVariable(ics.ComponentPropertySummary),
+	"description": exprPropertyVariable(ics.ComponentPropertyDescription),
+	"location":    exprPropertyVariable(ics.ComponentPropertyLocation),
+	"status":      exprPropertyVariable(ics.ComponentPropertyStatus),
+	"organizer":   exprPropertyVariable(ics.ComponentPropertyOrganizer),
+	"uid":         exprPropertyVariable(ics.ComponentPropertyUniqueId),
+	"url":         exprPropertyVariable(ics.ComponentPropertyUrl),
+	"type": func(env *exprEnv) (interface{}, error) {
+		return getItemType(env.item), nil
+	},
+	"categories": func(env *exprEnv) (interface{}, error) {
+		categories := getCategories(env.itemBase)
+		if categories == nil {
+			categories = []string{}
+		}
+		return categories, nil
+	},
+	"start": func(env *exprEnv) (interface{}, error) {
+		start, _, _, err := getItemTimes(env.item, env.loc)
+		return start, err
+	},
+	"end": func(env *exprEnv) (interface{}, error) {
+		_, end, _, err := getItemTimes(env.item, env.loc)
+		return end, err
+	},
+	"duration": func(env *exprEnv) (interface{}, error) {
+		start, end, _, err := getItemTimes(env.item, env.loc)
+		return end.Sub(start), err
+	},
+	"allday": func(env *exprEnv) (interface{}, error) {
+		return isAllDay(env.itemBase), nil
+	},
+	"due":       exprTimeVariable(ics.ComponentProperty(ics.PropertyDue)),
+	"completed": exprTimeVariable(ics.ComponentProperty(ics.PropertyCompleted)),
+	"true":      func(env *exprEnv) (interface{}, error) { return true, nil },
+	"false":     func(env *exprEnv) (interface{}, error) { return false, nil },
+}
+
+func exprPropertyVariable(property ics.ComponentProperty) func(env *exprEnv) (interface{}, error) {
+	return func(env *exprEnv) (interface{}, error) {
+		return ics.FromText(getPropertyValue(env.itemBase, property)), nil
+	}
+}
+
+// exprTimeVariable returns the time of a property, e.g. DUE of todos. It's an error, if the property isn't set.
+func exprTimeVariable(property ics.ComponentProperty) func(env *exprEnv) (interface{}, error) {
+	return func(env *exprEnv) (interface{}, error) {
+		prop := env.itemBase.GetProperty(property)
+		if prop == nil {
+			return nil, fmt.Errorf("%s has no %s", getItemId(env.itemBase), property)
+		}
+		t, _, err := parseICalTime(prop, env.loc)
+		return t, err
+	}
+}
+
+type exprFunction struct {
+	args []string // types of the arguments, "any" accepts all types
+	call func(env *exprEnv, args []interface{}) (interface{}, error)
+}
+
+// functions available in expressions
+var exprFunctions = map[string]exprFunction{
+	// weekday of a time as short english name, e.g. "Fri"
+	"weekday": {[]string{"time"}, func(env *exprEnv, args []interface{}) (interface{}, error) {
+		return args[0].(time.Time).In(env.loc).Format("Mon"), nil
+	}},
+	"hour": {[]string{"time"}, func(env *exprEnv, args []interface{}) (interface{}, error) {
+		return float64(args[0].(time.Time).In(env.loc).Hour()), nil
+	}},
+	"minute": {[]string{"time"}, func(env *exprEnv, args []interface{}) (interface{}, error) {
+		return float64(args[0].(time.Time).In(env.loc).Minute()), nil
+	}},
+	// date of a time, e.g. "2024-01-31"
+	"date": {[]string{"time"}, func(env *exprEnv, args []interface{}) (interface{}, error) {
+		return args[0].(time.Time).In(env.loc).Format("2006-01-02"), nil
+	}},
+	// time of day, e.g. "14:30"
+	"clock": {[]string{"time"}, func(env *exprEnv, args []interface{}) (interface{}, error) {
+		return args[0].(time.Time).In(env.loc).Format("15:04"), nil
+	}},
+	// formats a time with a Go layout, e.g. format(start, "02.01.2006")
+	"format": {[]string{"time", "string"}, func(env *exprEnv, args []interface{}) (interface{}, error) {
+		return args[0].(time.Time).In(env.loc).Format(args[1].(string)), nil
+	}},
+	"lower": {[]string{"string"}, func(env *exprEnv, args []interface{}) (interface{}, error) {
+		return strings.ToLower(args[0].(string)), nil
+	}},
+	"upper": {[]string{"string"}, func(env *exprEnv, args []interface{}) (interface{}, error) {
+		return strings.ToUpper(args[0].(string)), nil
+	}},
+	"trim": {[]string{"string"}, func(env *exprEnv, args []interface{}) (interface{}, error) {
+		return strings.TrimSpace(args[0].(string)), nil
+	}},
+	// contains(string, substring) or contains(list, element)
+	"contains": {[]string{"any", "string"}, func(env *exprEnv, args []interface{}) (interface{}, error) {
+		switch v := args[0].(type) {
+		case string:
+			return strings.Contains(v, args[1].(string)), nil
+		case []string:
+			return contains(v, args[1].(string)), nil
+		}
+		return nil, fmt.Errorf("contains() expects a string or list, got %s", exprTypeName(args[0]))
+	}},
+	"len": {[]string{"any"}, func(env *exprEnv, args []interface{}) (interface{}, error) {
+		switch v := args[0].(type) {
+		case string:
+			return float64(len([]rune(v))), nil
+		case []string:
+			return float64(len(v)), nil
+		}
+		return nil, fmt.Errorf("len() expects a string or list, got %s", exprTypeName(args[0]))
+	}},
+	// replace(string, regex, replacement), the replacement may contain $1 etc.
+	"replace": {[]string{"string", "string", "string"}, func(env *exprEnv, args []interface{}) (interface{}, error) {
+		re, err := regexp.Compile(args[1].(string))
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex in replace(): %s", err.Error())
+		}
+		return re.ReplaceAllString(args[0].(string), args[2].(string)), nil
+	}},
+	// value of any property, e.g. prop("X-COURSE"). Empty if not set.
+	"prop": {[]string{"string"}, func(env *exprEnv, args []interface{}) (interface{}, error) {
+		return ics.FromText(getPropertyValue(env.itemBase, ics.ComponentProperty(strings.ToUpper(args[0].(string))))), nil
+	}},
+	"exists": {[]string{"string"}, func(env *exprEnv, args []interface{}) (interface{}, error) {
+		return env.itemBase.GetProperty(ics.ComponentProperty(strings.ToUpper(args[0].(string)))) != nil, nil
+	}},
+}
+
+// compileExpression parses an expression. Errors are reported with the position in the expression.
+func compileExpression(expr string) (exprNode, error) {
+	if len(expr) > exprMaxLength {
+		return nil, fmt.Errorf("expression is longer than %d characters", exprMaxLength)
+	}
+	tokens, err := tokenizeExpression(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{tokens: tokens}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.peek().kind != tokenEOF {
+		return nil, fmt.Errorf("unexpected '%s' at position %d", p.peek().text, p.peek().pos)
+	}
+	return node, nil
+}
+
+// evalExpression evaluates a compiled expression for an event, todo or journal entry.
+func evalExpression(node exprNode, item ics.Component, loc *time.Location) (interface{}, error) {
+	return node.eval(&exprEnv{item: item, itemBase: getItemBase(item), loc: loc})
+}
+
+// evalCondition evaluates a compiled expression, which has to return a boolean.
+func evalCondition(node exprNode, item ics.Component, loc *time.Location) (bool, error) {
+	v, err := evalExpression(node, item, loc)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("expression returned %s, not bool", exprTypeName(v))
+	}
+	return b, nil
+}
+
+// --- tokenizer
+
+const (
+	tokenEOF = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenDuration
+	tokenOperator
+)
+
+type exprToken struct {
+	kind  int
+	text  string
+	pos   int
+	value interface{}
+}
+
+var exprOperators = []string{"||", "&&", "==", "!=", "=~", "!~", "<=", ">=", "<", ">", "!", "+", "-", "(", ")", ","}
+
+// words which can be used instead of the logical operators
+var exprKeywords = map[string]string{
+	"or":  "||",
+	"and": "&&",
+	"not": "!",
+}
+
+// tokenizeExpression splits an expression into tokens. Positions are counted in characters, not bytes.
+func tokenizeExpression(expr string) ([]exprToken, error) {
+	var tokens []exprToken
+	runes := []rune(expr)
+	isIdentRune := func(c rune) bool {
+		return unicode.IsLetter(c) || unicode.IsDigit(c) || c == '_'
+	}
+	i := 0
+	for i < len(runes) {
+		c := runes[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '"':
+			// find the closing quote, skipping escaped characters
+			j := i + 1
+			for j < len(runes) && runes[j] != '"' {
+				if runes[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(runes) {
+				return nil, fmt.Errorf("unterminated string at position %d", i)
+			}
+			text := string(runes[i : j+1])
+			s, err := strconv.Unquote(text)
+			if err != nil {
+				return nil, fmt.Errorf("invalid string at position %d: %s", i, err.Error())
+			}
+			tokens = append(tokens, exprToken{kind: tokenString, text: text, pos: i, value: s})
+			i = j + 1
+		case unicode.IsDigit(c):
+			j := i
+			for j < len(runes) && (unicode.IsDigit(runes[j]) || runes[j] == '.') {
+				j++
+			}
+			if j < len(runes) && unicode.IsLetter(runes[j]) {
+				// duration literal like 2h or 1h30m
+				for j < len(runes) && (isIdentRune(runes[j]) || runes[j] == '.') {
+					j++
+				}
+				text := string(runes[i:j])
+				d, err := parseExprDuration(text)
+				if err != nil {
+					return nil, fmt.Errorf("invalid duration '%s' at position %d", text, i)
+				}
+				tokens = append(tokens, exprToken{kind: tokenDuration, text: text, pos: i, value: d})
+			} else {
+				text := string(runes[i:j])
+				n, err := strconv.ParseFloat(text, 64)
+				if err != nil {
+					return nil, fmt.Errorf("invalid number '%s' at position %d", text, i)
+				}
+				tokens = append(tokens, exprToken{kind: tokenNumber, text: text, pos: i, value: n})
+			}
+			i = j
+		case unicode.IsLetter(c) || c == '_':
+			j := i
+			for j < len(runes) && isIdentRune(runes[j]) {
+				j++
+			}
+			text := string(runes[i:j])
+			if op, ok := exprKeywords[text]; ok {
+				tokens = append(tokens, exprToken{kind: tokenOperator, text: op, pos: i})
+			} else {
+				tokens = append(tokens, exprToken{kind: tokenIdent, text: text, pos: i})
+			}
+			i = j
+		default:
+			found := false
+			for _, op := range exprOperators {
+				if strings.HasPrefix(string(runes[i:]), op) {
+					tokens = append(tokens, exprToken{kind: tokenOperator, text: op, pos: i})
+					i += len([]rune(op))
+					found = true
+					break
+				}
+			}
+			if !found {
+				return nil, fmt.Errorf("unexpected character '%c' at position %d", c, i)
+			}
+		}
+	}
+	return append(tokens, exprToken{kind: tokenEOF, text: "end of expression", pos: len(runes)}), nil
+}
+
+// parseExprDuration parses a duration literal. In addition to time.ParseDuration, whole days ("2d") are supported.
+func parseExprDuration(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		n, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
+
+// --- parser
+
+type exprParser struct {
+	tokens []exprToken
+	pos    int
+	depth  int
+}
+
+func (p *exprParser) peek() exprToken {
+	return p.tokens[p.pos]
+}
+
+func (p *exprParser) next() exprToken {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *exprParser) isOperator(ops ...string) bool {
+	t := p.peek()
+	return t.kind == tokenOperator && contains(ops, t.text)
+}
+
+func (p *exprParser) parseOr() (exprNode, error) {
+	p.depth++
+	defer func() { p.depth-- }()
+	if p.depth > exprMaxDepth {
+		return nil, fmt.Errorf("expression is nested too deeply")
+	}
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator("||") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &exprLogical{op: "||", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseAnd() (exprNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator("&&") {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &exprLogical{op: "&&", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseNot() (exprNode, error) {
+	if p.isOperator("!") {
+		p.next()
+		p.depth++
+		defer func() { p.depth-- }()
+		if p.depth > exprMaxDepth {
+			return nil, fmt.Errorf("expression is nested too deeply")
+		}
+		operand, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &exprNot{operand: operand}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *exprParser) parseComparison() (exprNode, error) {
+	left, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	if !p.isOperator("==", "!=", "=~", "!~", "<", "<=", ">", ">=") {
+		return left, nil
+	}
+	op := p.next()
+	right, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	node := &exprComparison{op: op.text, left: left, right: right}
+	if op.text == "=~" || op.text == "!~" {
+		// compile constant regexes once
+		if lit, ok := right.(*exprLiteral); ok {
+			s, ok := lit.value.(string)
+			if !ok {
+				return nil, fmt.Errorf("'%s' at position %d expects a regex string", op.text, op.pos)
+			}
+			node.regex, err = regexp.Compile(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid regex at position %d: %s", op.pos, err.Error())
+			}
+		}
+	}
+	if p.isOperator("==", "!=", "=~", "!~", "<", "<=", ">", ">=") {
+		return nil, fmt.Errorf("comparisons can't be chained, use '&&' (position %d)", p.peek().pos)
+	}
+	return node, nil
+}
+
+func (p *exprParser) parseSum() (exprNode, error) {
+	left, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isOperator("+", "-") {
+		op := p.next()
+		right, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		left = &exprArithmetic{op: op.text, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	t := p.next()
+	switch t.kind {
+	case tokenString, tokenNumber, tokenDuration:
+		return &exprLiteral{value: t.value}, nil
+	case tokenIdent:
+		if p.isOperator("(") {
+			return p.parseCall(t)
+		}
+		variable, ok := exprVariables[t.text]
+		if !ok {
+			return nil, fmt.Errorf("unknown variable '%s' at position %d", t.text, t.pos)
+		}
+		return &exprVariable{name: t.text, get: variable}, nil
+	case tokenOperator:
+		switch t.text {
+		case "(":
+			node, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if !p.isOperator(")") {
+				return nil, fmt.Errorf("missing ')' at position %d", p.peek().pos)
+			}
+			p.next()
+			return node, nil
+		case "-":
+			operand, err := p.parsePrimary()
+			if err != nil {
+				return nil, err
+			}
+			return &exprArithmetic{op: "-", left: &exprLiteral{value: float64(0)}, right: operand, negate: true}, nil
+		}
+	}
+	return nil, fmt.Errorf("unexpected '%s' at position %d", t.text, t.pos)
+}
+
+func (p *exprParser) parseCall(name exprToken) (exprNode, error) {
+	function, ok := exprFunctions[name.text]
+	if !ok {
+		return nil, fmt.Errorf("unknown function '%s' at position %d", name.text, name.pos)
+	}
+	p.next() // (
+	var args []exprNode
+	for !p.isOperator(")") {
+		if len(args) > 0 {
+			if !p.isOperator(",") {
+				return nil, fmt.Errorf("expected ',' or ')' at position %d", p.peek().pos)
+			}
+			p.next()
+		}
+		arg, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	p.next() // )
+	if len(args) != len(function.args) {
+		return nil, fmt.Errorf("function '%s' at position %d expects %d arguments, got %d", name.text, name.pos, len(function.args), len(args))
+	}
+	return &exprCall{name: name.text, function: function, args: args}, nil
+}
+
+// --- nodes
+
+type exprLiteral struct {
+	value interface{}
+}
+
+func (n *exprLiteral) eval(env *exprEnv) (interface{}, error) {
+	return n.value, nil
+}
+
+type exprVariable struct {
+	name string
+	get  func(env *exprEnv) (interface{}, error)
+}
+
+func (n *exprVariable) eval(env *exprEnv) (interface{}, error) {
+	return n.get(env)
+}
+
+type exprCall struct {
+	name     string
+	function exprFunction
+	args     []exprNode
+}
+
+func (n *exprCall) eval(env *exprEnv) (interface{}, error) {
+	var args []interface{}
+	for i, arg := range n.args {
+		v, err := arg.eval(env)
+		if err != nil {
+			return nil, err
+		}
+		if n.function.args[i] != "any" && exprTypeName(v) != n.function.args[i] {
+			return nil, fmt.Errorf("argument %d of %s() has to be %s, got %s", i+1, n.name, n.function.args[i], exprTypeName(v))
+		}
+		args = append(args, v)
+	}
+	return n.function.call(env, args)
+}
+
+type exprNot struct {
+	operand exprNode
+}
+
+func (n *exprNot) eval(env *exprEnv) (interface{}, error) {
+	b, err := evalBool(n.operand, env, "!")
+	if err != nil {
+		return nil, err
+	}
+	return !b, nil
+}
+
+type exprLogical struct {
+	op          string
+	left, right exprNode
+}
+
+func (n *exprLogical) eval(env *exprEnv) (interface{}, error) {
+	left, err := evalBool(n.left, env, n.op)
+	if err != nil {
+		return nil, err
+	}
+	// short circuit
+	if left == (n.op == "||") {
+		return left, nil
+	}
+	return evalBool(n.right, env, n.op)
+}
+
+func evalBool(node exprNode, env *exprEnv, op string) (bool, error) {
+	v, err := node.eval(env)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("'%s' expects bool, got %s", op, exprTypeName(v))
+	}
+	return b, nil
+}
+
+type exprComparison struct {
+	op          string
+	left, right exprNode
+	regex       *regexp.Regexp
+}
+
+func (n *exprComparison) eval(env *exprEnv) (interface{}, error) {
+	left, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+
+	if n.op == "=~" || n.op == "!~" {
+		re := n.regex
+		if re == nil {
+			s, ok := right.(string)
+			if !ok {
+				return nil, fmt.Errorf("'%s' expects a regex string, got %s", n.op, exprTypeName(right))
+			}
+			re, err = regexp.Compile(s)
+			if err != nil {
+				return nil, fmt.Errorf("invalid regex: %s", err.Error())
+			}
+		}
+		var matched bool
+		switch v := left.(type) {
+		case string:
+			matched = re.MatchString(v)
+		case []string:
+			// lists match, if any element matches
+			for _, s := range v {
+				matched = matched || re.MatchString(s)
+			}
+		default:
+			return nil, fmt.Errorf("'%s' expects a string or list, got %s", n.op, exprTypeName(left))
+		}
+		return matched == (n.op == "=~"), nil
+	}
+
+	// times can be compared with time expressions
+	if t, ok := left.(time.Time); ok {
+		if s, ok := right.(string); ok {
+			right, err = parseTimeExpression(s, env.loc)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if r, ok := right.(time.Time); ok {
+			return compareResult(n.op, compareTimes(t, r))
+		}
+	}
+	if s, ok := left.(string); ok {
+		if t, ok := right.(time.Time); ok {
+			l, err := parseTimeExpression(s, env.loc)
+			if err != nil {
+				return nil, err
+			}
+			return compareResult(n.op, compareTimes(l, t))
+		}
+	}
+
+	if exprTypeName(left) != exprTypeName(right) {
+		return nil, fmt.Errorf("can't compare %s with %s", exprTypeName(left), exprTypeName(right))
+	}
+	switch l := left.(type) {
+	case string:
+		return compareResult(n.op, strings.Compare(l, right.(string)))
+	case float64:
+		return compareResult(n.op, compareFloats(l, right.(float64)))
+	case time.Duration:
+		return compareResult(n.op, compareFloats(float64(l), float64(right.(time.Duration))))
+	case bool:
+		if n.op != "==" && n.op != "!=" {
+			return nil, fmt.Errorf("bools can only be compared with '==' and '!='")
+		}
+		return (l == right.(bool)) == (n.op == "=="), nil
+	case []string:
+		if n.op != "==" && n.op != "!=" {
+			return nil, fmt.Errorf("lists can only be compared with '==' and '!='")
+		}
+		return (strings.Join(l, ",") == strings.Join(right.([]string), ",")) == (n.op == "=="), nil
+	}
+	return nil, fmt.Errorf("can't compare %s", exprTypeName(left))
+}
+
+func compareTimes(a, b time.Time) int {
+	switch {
+	case a.Before(b):
+		return -1
+	case a.After(b):
+		return 1
+	}
+	return 0
+}
+
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func compareResult(op string, c int) (interface{}, error) {
+	switch op {
+	case "==":
+		return c == 0, nil
+	case "!=":
+		return c != 0, nil
+	case "<":
+		return c < 0, nil
+	case "<=":
+		return c <= 0, nil
+	case ">":
+		return c > 0, nil
+	case ">=":
+		return c >= 0, nil
+	}
+	return nil, fmt.Errorf("unknown operator '%s'", op)
+}
+
+type exprArithmetic struct {
+	op          string
+	left, right exprNode
+	negate      bool // unary minus, left is 0
+}
+
+func (n *exprArithmetic) eval(env *exprEnv) (interface{}, error) {
+	left, err := n.left.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	right, err := n.right.eval(env)
+	if err != nil {
+		return nil, err
+	}
+	if n.negate {
+		switch r := right.(type) {
+		case float64:
+			return -r, nil
+		case time.Duration:
+			return -r, nil
+		}
+		return nil, fmt.Errorf("can't negate %s", exprTypeName(right))
+	}
+
+	switch l := left.(type) {
+	case string:
+		if n.op == "+" {
+			return l + exprToString(right), nil
+		}
+	case float64:
+		if r, ok := right.(float64); ok {
+			if n.op == "+" {
+				return l + r, nil
+			}
+			return l - r, nil
+		}
+	case time.Duration:
+		if r, ok := right.(time.Duration); ok {
+			if n.op == "+" {
+				return l + r, nil
+			}
+			return l - r, nil
+		}
+	case time.Time:
+		switch r := right.(type) {
+		case time.Duration:
+			if n.op == "+" {
+				return l.Add(r), nil
+			}
+			return l.Add(-r), nil
+		case time.Time:
+			if n.op == "-" {
+				return l.Sub(r), nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("can't use '%s' with %s and %s", n.op, exprTypeName(left), exprTypeName(right))
+}
+
+// exprTypeName returns the name of the type of a value, as used in error messages and exprFunction.args
+func exprTypeName(v interface{}) string {
+	switch v.(type) {
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "bool"
+	case time.Duration:
+		return "duration"
+	case time.Time:
+		return "time"
+	case []string:
+		return "list"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// exprToString converts a value to text. Times are formatted in UTC as iCalendar DATE-TIME.
+func exprToString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Duration:
+		return v.String()
+	case time.Time:
+		return v.UTC().Format(icalDateTimeFormatUTC)
+	case []string:
+		return strings.Join(v, ",")
+	}
+	return fmt.Sprint(v)
+}
+
+// parseExpressionParams compiles the condition and the assignments of the 'expression' module.
+func parseExpressionParams(params map[string]string) (exprNode, map[string]exprNode, error) {
+	var condition exprNode
+	var err error
+	if params["expression"] != "" {
+		condition, err = compileExpression(params["expression"])
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid expression: %s", err.Error())
+		}
+	}
+	assignments := make(map[string]exprNode)
+	for k, v := range params {
+		if !strings.HasPrefix(k, "set-") || len(k) == len("set-") {
+			continue
+		}
+		assignments[strings.ToUpper(strings.TrimPrefix(k, "set-"))], err = compileExpression(v)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid expression in '%s': %s", k, err.Error())
+		}
+	}
+	if condition == nil && len(assignments) == 0 {
+		return nil, nil, fmt.Errorf("missing mandatory Parameter 'expression'")
+	}
+	switch params["mode"] {
+	case "", "edit", "keep-only":
+	case "delete", "cancel":
+		if len(assignments) > 0 {
+			return nil, nil, fmt.Errorf("assignments can't be used with mode '%s'", params["mode"])
+		}
+	default:
+		return nil, nil, fmt.Errorf("invalid mode '%s', must be 'delete', 'cancel', 'keep-only' or 'edit'", params["mode"])
+	}
+	return condition, assignments, nil
+}
+
+// validateExpressionModule checks the expressions of the 'expression' module, before it is saved.
+func validateExpressionModule(params map[string]string) error {
+	_, _, err := parseExpressionParams(params)
+	if err == nil {
+		_, err = getParamLocation(params)
+	}
+	return err
+}
+
+// This module deletes, keeps or edits events depending on an expression, e.g. `summary =~ "Lab" && weekday(start) == "Fri" && duration > 2h`.
+// The expression language is described at the top of this file.
+// Parameters:
+// - 'expression', mandatory without assignments: condition deciding which events are handled
+// - 'set-<PROPERTY>', optional: expression whose result is written to the property of matching events, e.g. 'set-SUMMARY: summary + " (Lab)"'
+// - 'mode', optional: "delete" (default without assignments) removes matching events, "keep-only" removes all other events,
+// "edit" (default with assignments) only applies the assignments, "cancel" keeps matching events with STATUS:CANCELLED
+// and an increased SEQUENCE
+// - 'prefix', optional: text prepended to the summary of cancelled events
+// Returns the number of events removed.
+func moduleExpression(cal *ics.Calendar, params map[string]string) (int, error) {
+	var count int
+	condition, assignments, err := parseExpressionParams(params)
+	if err != nil {
+		return 0, err
+	}
+	if params["mode"] == "" {
+		params["mode"] = "delete"
+		if len(assignments) > 0 {
+			params["mode"] = "edit"
+		}
+	}
+	loc, err := getParamLocation(params)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := len(cal.Components) - 1; i >= 0; i-- { // iterate over events backwards
+		switch cal.Components[i].(type) {
+		case *ics.VEvent, *ics.VTodo, *ics.VJournal:
+			item := getItemBase(cal.Components[i])
+			matched := true
+			if condition != nil {
+				matched, err = evalCondition(condition, cal.Components[i], loc)
+				if err != nil {
+					log.Warnf("Skipping event: %s", err.Error())
+					continue
+				}
+			}
+			switch {
+			case params["mode"] == "delete" && matched, params["mode"] == "cancel" && matched, params["mode"] == "keep-only" && !matched:
+				count += deleteOrCancelEvent(cal, i, params)
+				continue
+			case !matched:
+				continue
+			}
+			if len(assignments) == 0 {
+				continue
+			}
+			// evaluate all assignments before changing the event, so they all see the original values
+			values := make(map[string]interface{})
+			for property, node := range assignments {
+				values[property], err = evalExpression(node, cal.Components[i], loc)
+				if err != nil {
+					break
+				}
+			}
+			if err != nil {
+				log.Warnf("Skipping event: %s", err.Error())
+				continue
+			}
+			for property, value := range values {
+				setExpressionResult(item, property, value)
+			}
+			log.Debug("Edited event with id " + getItemId(item) + "\n")
+		}
+	}
+	return count, nil
+}
+
+// setExpressionResult writes the result of an assignment to a property. Text is escaped, times are written in UTC.
+func setExpressionResult(item *ics.ComponentBase, property string, value interface{}) {
+	switch v := value.(type) {
+	case string:
+		item.SetProperty(ics.ComponentProperty(property), ics.ToText(v))
+	case []string:
+		var escaped []string
+		for _, s := range v {
+			escaped = append(escaped, ics.ToText(s))
+		}
+		item.SetProperty(ics.ComponentProperty(property), strings.Join(escaped, ","))
+	default:
+		item.SetProperty(ics.ComponentProperty(property), exprToString(v))
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	ics "github.com/arran4/golang-ical"
+)
+
+// testCalendar parses a calendar with the given components, e.g. "BEGIN:VEVENT\n...\nEND:VEVENT"
+func testCalendar(t *testing.T, components string) *ics.Calendar {
+	t.Helper()
+	data := "BEGIN:VCALENDAR\nVERSION:2.0\nPRODID:test\n" + components + "\nEND:VCALENDAR\n"
+	cal, err := ics.ParseCalendar(strings.NewReader(strings.ReplaceAll(data, "\n", "\r\n")))
+	if err != nil {
+		t.Fatalf("invalid test calendar: %v", err)
+	}
+	return cal
+}
+
+const testExprEvent = `BEGIN:VEVENT
+UID:test-1
+DTSTAMP:20240101T000000Z
+DTSTART:20240119T140000Z
+DTEND:20240119T170000Z
+SUMMARY:Lab Übung
+DESCRIPTION:Raum 1\, Gebäude B
+LOCATION:Hörsaal 1
+CATEGORIES:Informatik,Lab
+END:VEVENT`
+
+func TestEvalExpression(t *testing.T) {
+	event := testCalendar(t, testExprEvent).Components[0]
+
+	tests := []struct {
+		expr string
+		want interface{}
+	}{
+		// variables and escaped property values
+		{`summary`, "Lab Übung"},
+		{`description`, "Raum 1, Gebäude B"},
+		{`location == "Hörsaal 1"`, true},
+		{`type`, "event"},
+		{`categories`, []string{"Informatik", "Lab"}},
+		{`summary =~ "^Lab" && weekday(start) == "Fri" && duration > 2h`, true},
+		// precedence: '&&' before '||', '!' before '&&', comparisons before '!', sums before comparisons
+		{`true || false && false`, true},
+		{`(true || false) && false`, false},
+		{`false && true || true`, true},
+		{`!true || true`, true},
+		{`!(true || true)`, false},
+		{`!summary =~ "Lab"`, false},
+		{`!!true`, true},
+		{`1 + 2 == 3`, true},
+		{`10 - 2 - 3`, float64(5)},
+		{`-2h + 3h`, time.Hour},
+		{`end - start == 3h`, true},
+		{`start + 1h30m == "2024-01-19T15:30:00Z"`, true},
+		// keywords
+		{`true or false and false`, true},
+		{`(true or false) and false`, false},
+		{`not false`, true},
+		{`not summary =~ "Lab"`, false},
+		{`summary == "x" or type == "event"`, true},
+		// strings, quoting and escapes
+		{`summary + "!"`, "Lab Übung!"},
+		{`"a" + 1`, "a1"},
+		{`"Tab\tQuote\" Backslash\\"`, "Tab\tQuote\" Backslash\\"},
+		{`"ü" == "ü"`, true},
+		{`"Grüße" == "Grüße"`, true},
+		{`len("Grüße")`, float64(5)},
+		{`lower("ÜBUNG")`, "übung"},
+		{`replace(summary, "Ü(b)ung", "$1")`, "Lab b"},
+		// lists and times
+		{`contains(categories, "Lab")`, true},
+		{`categories =~ "^Inf"`, true},
+		{`categories !~ "^Lab$"`, false},
+		{`start > "2024-01-01" and end < "2024-01-20"`, true},
+		{`hour(start)`, float64(14)},
+		{`clock(end)`, "17:00"},
+		{`date(start)`, "2024-01-19"},
+		{`format(start, "02.01.2006")`, "19.01.2024"},
+		{`allday`, false},
+		{`prop("x-course")`, ""},
+		{`exists("LOCATION") && !exists("X-COURSE")`, true},
+	}
+	for _, test := range tests {
+		node, err := compileExpression(test.expr)
+		if err != nil {
+			t.Errorf("compileExpression(%s): unexpected error: %v", test.expr, err)
+			continue
+		}
+		got, err := evalExpression(node, event, time.UTC)
+		if err != nil {
+			t.Errorf("evalExpression(%s): unexpected error: %v", test.expr, err)
+			continue
+		}
+		if exprTypeName(got) != exprTypeName(test.want) || exprToString(got) != exprToString(test.want) {
+			t.Errorf("evalExpression(%s) = %#v, want %#v", test.expr, got, test.want)
+		}
+	}
+}
+
+func TestCompileExpressionErrors(t *testing.T) {
+	tests := []string{
+		``,
+		`   `,
+		`foo`,
+		`orange == 1`,
+		`unknown()`,
+		`summary ==`,
+		`== summary`,
+		`summary == "a" == "b"`,
+		`summary =~ "["`,
+		`summary =~ 1`,
+		`"unterminated`,
+		`"ends with backslash\`,
+		`"bad \q escape"`,
+		`1.2.3`,
+		`2x`,
+		`()`,
+		`(summary`,
+		`summary)`,
+		`lower(summary`,
+		`lower(,)`,
+		`lower(summary, 1)`,
+		`lower()`,
+		`a @ b`,
+		`§`,
+		`and`,
+		`or true`,
+		`not`,
+		`summary !`,
+		`true && && false`,
+		`-`,
+		strings.Repeat("(", exprMaxDepth+1) + "true" + strings.Repeat(")", exprMaxDepth+1),
+		strings.Repeat("!", exprMaxDepth+1) + "true",
+		strings.Repeat("a", exprMaxLength+1),
+	}
+	for _, expr := range tests {
+		if _, err := compileExpression(expr); err == nil {
+			t.Errorf("compileExpression(%q): expected an error", expr)
+		}
+	}
+
+	// positions are counted in characters
+	_, err := compileExpression(`"Grüße" @`)
+	if err == nil || !strings.Contains(err.Error(), "position 8") {
+		t.Errorf("expected an error at position 8, got %v", err)
+	}
+}
+
+func TestEvalExpressionErrors(t *testing.T) {
+	event := testCalendar(t, testExprEvent).Components[0]
+	tests := []string{
+		`summary > 2`,
+		`-summary`,
+		`summary && true`,
+		`!summary`,
+		`hour(summary)`,
+		`start < "soon"`,
+		`due`,
+		`summary =~ lower("[")`,
+		`categories < categories`,
+		`start + start`,
+	}
+	for _, expr := range tests {
+		node, err := compileExpression(expr)
+		if err != nil {
+			t.Errorf("compileExpression(%s): unexpected error: %v", expr, err)
+			continue
+		}
+		if got, err := evalExpression(node, event, time.UTC); err == nil {
+			t.Errorf("evalExpression(%s) = %#v, expected an error", expr, got)
+		}
+	}
+
+	node, err := compileExpression(`summary`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := evalCondition(node, event, time.UTC); err == nil {
+		t.Error("evalCondition of a string: expected an error")
+	}
+}
+
+func TestModuleExpression(t *testing.T) {
+	events := testExprEvent + "\n" + strings.Replace(strings.Replace(testExprEvent, "UID:test-1", "UID:test-2", 1), "SUMMARY:Lab Übung", "SUMMARY:Vorlesung", 1)
+	tests := []struct {
+		params    map[string]string
+		wantCount int
+		wantIds   []string
+	}{
+		{map[string]string{"expression": `summary =~ "Lab"`}, -1, []string{"test-2"}},
+		{map[string]string{"expression": `summary =~ "Lab"`, "mode": "keep-only"}, -1, []string{"test-1"}},
+		{map[string]string{"expression": `summary =~ "Lab"`, "mode": "cancel"}, 0, []string{"test-1", "test-2"}},
+		// edited events are neither added nor removed
+		{map[string]string{"expression": `summary =~ "Lab"`, "set-SUMMARY": `upper(summary)`}, 0, []string{"test-1", "test-2"}},
+		{map[string]string{"set-LOCATION": `location + " (verlegt)"`}, 0, []string{"test-1", "test-2"}},
+	}
+	for _, test := range tests {
+		cal := testCalendar(t, events)
+		test.params["timezone"] = "UTC"
+		count, err := moduleExpression(cal, test.params)
+		if err != nil {
+			t.Errorf("moduleExpression(%v): unexpected error: %v", test.params, err)
+			continue
+		}
+		var ids []string
+		for _, event := range cal.Events() {
+			ids = append(ids, event.Id())
+		}
+		if count != test.wantCount || strings.Join(ids, ",") != strings.Join(test.wantIds, ",") {
+			t.Errorf("moduleExpression(%v) = %d %v, want %d %v", test.params, count, ids, test.wantCount, test.wantIds)
+		}
+	}
+
+	cal := testCalendar(t, events)
+	if _, err := moduleExpression(cal, map[string]string{"set-SUMMARY": `upper(summary)`, "timezone": "UTC"}); err != nil {
+		t.Fatal(err)
+	}
+	if summary := getPropertyValue(&cal.Events()[0].ComponentBase, ics.ComponentPropertySummary); summary != "LAB ÜBUNG" {
+		t.Errorf("set-SUMMARY wrote %q, want %q", summary, "LAB ÜBUNG")
+	}
+}
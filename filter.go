@@ -0,0 +1,212 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	ics "github.com/arran4/golang-ical"
+	log "github.com/sirupsen/logrus"
+)
+
+// operators of match rules, as used in the parameter prefix. Longer prefixes have to come first.
+var matchOperators = []string{"not-regex", "not-equals", "regex", "equals", "exists"}
+
+type matchRule struct {
+	operator string
+	property string
+	value    string
+	regex    *regexp.Regexp
+}
+
+// eventMatcher decides if an event is handled by a module, based on match rules and an optional timeframe.
+type eventMatcher struct {
+	rules        []matchRule
+	any          bool // combine rules with OR instead of AND
+	hasTimeframe bool
+	after        time.Time
+	before       time.Time
+	loc          *time.Location
+}
+
+// parseEventMatcher reads the match rules and timeframe from module parameters.
+// Match rules are parameters named '<operator>-<PROPERTY>', e.g. 'regex-LOCATION' or 'exists-X-COURSE':
+//   - 'regex-<PROPERTY>': the property matches the regular expression
+//   - 'not-regex-<PROPERTY>': the property doesn't match the regular expression, or is not set
+//   - 'equals-<PROPERTY>': the property is equal to the value
+//   - 'not-equals-<PROPERTY>': the property is not equal to the value, or is not set
+//   - 'exists-<PROPERTY>': "true" if the property has to be set, "false" if it must not be set
+//
+// Properties that can occur multiple times, like ATTENDEE, match if any of them matches. CATEGORIES are compared one by one.
+// 'combine' sets how rules are combined, "and" (default) or "or".
+// The timeframe is set with 'after', 'before' and 'period' (see parseTimeframe). Events match it, if they start in it.
+func parseEventMatcher(params map[string]string) (*eventMatcher, error) {
+	m := &eventMatcher{}
+	switch params["combine"] {
+	case "", "and":
+	case "or":
+		m.any = true
+	default:
+		return nil, fmt.Errorf("invalid value for 'combine': %s", params["combine"])
+	}
+
+	var err error
+	m.loc, err = getParamLocation(params)
+	if err != nil {
+		return nil, err
+	}
+	if params["after"] != "" || params["before"] != "" || params["period"] != "" {
+		m.hasTimeframe = true
+		m.after, m.before, err = parseTimeframe(params, "after", "before", m.loc)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// sort keys for a stable order of rules
+	var keys []string
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for _, op := range matchOperators {
+			if !strings.HasPrefix(k, op+"-") || len(k) == len(op)+1 {
+				continue
+			}
+			rule := matchRule{operator: op, property: strings.ToUpper(strings.TrimPrefix(k, op+"-")), value: params[k]}
+			switch op {
+			case "regex", "not-regex":
+				rule.regex, err = regexp.Compile(params[k])
+				if err != nil {
+					return nil, fmt.Errorf("invalid regex in '%s': %s", k, err.Error())
+				}
+			case "exists":
+				if params[k] != "true" && params[k] != "false" {
+					return nil, fmt.Errorf("invalid value for '%s', must be 'true' or 'false'", k)
+				}
+			}
+			m.rules = append(m.rules, rule)
+			break
+		}
+	}
+	return m, nil
+}
+
+// getPropertyValues returns the unescaped values of all properties with the given name.
+// CATEGORIES are split into the single categories.
+func getPropertyValues(component *ics.ComponentBase, property string) []string {
+	if property == string(ics.ComponentPropertyCategories) {
+		return getCategories(component)
+	}
+	var values []string
+	for _, p := range component.Properties {
+		if p.IANAToken == property {
+			values = append(values, ics.FromText(p.Value))
+		}
+	}
+	return values
+}
+
+// matches returns true, if the property values fulfill the rule
+func (r matchRule) matches(values []string) bool {
+	switch r.operator {
+	case "exists":
+		return (len(values) > 0) == (r.value == "true")
+	case "regex", "equals":
+		for _, v := range values {
+			if (r.regex != nil && r.regex.MatchString(v)) || (r.regex == nil && v == r.value) {
+				return true
+			}
+		}
+		return false
+	case "not-regex", "not-equals":
+		for _, v := range values {
+			if (r.regex != nil && r.regex.MatchString(v)) || (r.regex == nil && v == r.value) {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// matches returns true, if the event, todo or journal entry is in the timeframe and fulfills the rules.
+// Without rules, all events in the timeframe match.
+func (m *eventMatcher) matches(component ics.Component) (bool, error) {
+	item := getItemBase(component)
+	if item == nil {
+		return false, nil
+	}
+	if m.hasTimeframe {
+		inTimeframe, err := eventInTimeframe(component, m.after, m.before, m.loc)
+		if err != nil || !inTimeframe {
+			return false, err
+		}
+	}
+	if len(m.rules) == 0 {
+		return true, nil
+	}
+	for _, rule := range m.rules {
+		matched := rule.matches(getPropertyValues(item, rule.property))
+		if matched && m.any {
+			return true, nil
+		}
+		if !matched && !m.any {
+			return false, nil
+		}
+	}
+	return !m.any, nil
+}
+
+// This module deletes events, todos and journal entries by matching any of their properties, e.g. STATUS, DUE or COMPLETED.
+// Parameters:
+// - match rules, at least one: '<operator>-<PROPERTY>', see parseEventMatcher. E.g. 'regex-LOCATION', 'equals-STATUS', 'exists-X-COURSE'
+// - 'combine', default "and": "and" if all rules have to match, "or" if one is enough
+// - 'mode', default "delete": "delete" removes the matching events, "keep-only" removes all events that don't match,
+// "cancel" keeps the matching events with STATUS:CANCELLED and an increased SEQUENCE
+// - 'prefix', optional: text prepended to the summary of cancelled events
+// - 'after', 'before', 'period', optional: only events starting in this timeframe match
+// Returns the number of events removed. (always negative)
+func moduleFilter(cal *ics.Calendar, params map[string]string) (int, error) {
+	var count int
+	if params["mode"] == "" {
+		params["mode"] = "delete"
+	}
+	if err := checkFilterMode(params); err != nil {
+		return 0, err
+	}
+	matcher, err := parseEventMatcher(params)
+	if err != nil {
+		return 0, err
+	}
+	if len(matcher.rules) == 0 {
+		return 0, fmt.Errorf("missing match rules, e.g. 'regex-SUMMARY'")
+	}
+
+	for i := len(cal.Components) - 1; i >= 0; i-- { // iterate over events backwards
+		switch cal.Components[i].(type) {
+		case *ics.VEvent, *ics.VTodo, *ics.VJournal:
+			matched, err := matcher.matches(cal.Components[i])
+			if err != nil {
+				log.Warnf("Skipping event: %s", err.Error())
+				continue
+			}
+			if matched == (params["mode"] != "keep-only") {
+				count += deleteOrCancelEvent(cal, i, params)
+			}
+		}
+	}
+	return count, nil
+}
+
+// checkFilterMode checks the 'mode' parameter of the filter module
+func checkFilterMode(params map[string]string) error {
+	switch params["mode"] {
+	case "", "delete", "keep-only", "cancel":
+		return nil
+	}
+	return fmt.Errorf("invalid mode '%s', must be 'delete', 'keep-only' or 'cancel'", params["mode"])
+}
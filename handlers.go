@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"html/template"
 	"net/http"
+	"net/url"
 	"time"
 
 	ics "github.com/arran4/golang-ical"
@@ -35,6 +36,10 @@ func initHandlers() {
 	router.HandleFunc("/api/notifier/{notifier}/recipient", NotifyRecipientApiHandler).Name("notifier")
 	router.HandleFunc("/api/profiles/{profile}/calentry", calendarEntryApiHandler).Name("calentry")
 	router.HandleFunc("/api/profiles/{profile}/modules", modulesApiHandler).Name("modules")
+	router.HandleFunc("/api/profiles/{profile}/conflicts", conflictsApiHandler).Methods("GET").Name("conflicts")
+	router.HandleFunc("/api/profiles/{profile}/metadata", metadataApiHandler).Name("metadata")
+	router.HandleFunc("/api/profiles/{profile}/tables", tablesApiHandler).Name("tables")
+	router.HandleFunc("/api/profiles/{profile}/tables/{table}", tablesApiHandler).Name("table")
 }
 
 func getGlobalTemplateData() map[string]interface{} {
@@ -105,14 +110,31 @@ func editViewHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	var event *ics.VEvent
 	for _, e := range calendar.Events() {
-		if e.GetProperty("UID").Value == uid {
+		if e.Id() == uid {
 			event = e
 			break
 		}
 	}
+	if event == nil {
+		err := fmt.Errorf("event '%s' doesn't exist in profile '%s'", uid, profileName)
+		tryRenderErrorOrFallback(w, r, http.StatusNotFound, err, err.Error())
+		return
+	}
+	start, end, allDay, err := getEventTimes(event, conf.getProfileLocation(profile))
+	if err != nil {
+		tryRenderErrorOrFallback(w, r, http.StatusInternalServerError, err, err.Error())
+		return
+	}
 	data := getGlobalTemplateData()
 	data["ProfileName"] = profileName
 	data["Event"] = event
+	data["UID"] = event.Id()
+	data["Summary"] = getPropertyValue(&event.ComponentBase, ics.ComponentPropertySummary)
+	data["Location"] = getPropertyValue(&event.ComponentBase, ics.ComponentPropertyLocation)
+	data["Description"] = getPropertyValue(&event.ComponentBase, ics.ComponentPropertyDescription)
+	data["Start"] = start
+	data["End"] = end
+	data["AllDay"] = allDay
 	htmlTemplates.ExecuteTemplate(w, "edit.html", data)
 }
 
@@ -149,45 +171,103 @@ func monthlyViewHandler(w http.ResponseWriter, r *http.Request) {
 		tryRenderErrorOrFallback(w, r, http.StatusInternalServerError, err, "Internal Server Error")
 		return
 	}
-	allEvents := getEventsByDay(calendar, profileName)
+	editURL := func(uid string) (*url.URL, error) {
+		return router.Get("editView").URL("profile", profileName, "uid", uid)
+	}
+	allEvents := getEventsByDay(calendar, conf.getProfileLocation(profile), editURL)
 	data := getGlobalTemplateData()
 	data["ProfileName"] = profileName
 	data["Events"] = allEvents
-	data["ImmutablePast"] = profile.ImmutablePast
+	resolved, err := conf.resolveProfile(profile)
+	if err != nil {
+		tryRenderErrorOrFallback(w, r, http.StatusInternalServerError, err, "Internal Server Error")
+		return
+	}
+	data["ImmutablePast"] = resolved.hasImmutablePast()
 	htmlTemplates.ExecuteTemplate(w, "monthly.html", data)
 }
 
-func getEventsByDay(calendar *ics.Calendar, profileName string) calendarDataByDay {
+// getEventsByDay groups the events, todos and journal entries by the day they start on in loc.
+// All-day events are added to every day they span. Todos are shown on the day they are due, open todos without date today.
+// editURL returns the URL of the edit view of an event, events aren't linked if it is nil.
+func getEventsByDay(calendar *ics.Calendar, loc *time.Location, editURL func(uid string) (*url.URL, error)) calendarDataByDay {
 	calendarDataByDay := make(calendarDataByDay)
-	for _, event := range calendar.Events() {
-		startTime, err := event.GetStartAt()
-		if err != nil {
-			log.Errorln(err)
+	for _, component := range calendar.Components {
+		event := getItemBase(component)
+		if event == nil {
 			continue
 		}
-		endTime, err := event.GetEndAt()
+		startTime, endTime, allDay, err := getItemTimes(component, loc)
+		if err == errUndated {
+			if getItemType(component) != "todo" || isCompleted(event) {
+				continue
+			}
+			// open todos without date are shown today
+			now := time.Now().In(loc)
+			endTime, allDay, err = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc), true, nil
+		}
 		if err != nil {
 			log.Errorln(err)
 			continue
 		}
-		edit_url, err := router.Get("editView").URL("profile", profileName, "uid", event.GetProperty("UID").Value)
-		if err != nil {
-			log.Errorln(err)
+		if getItemType(component) == "todo" {
+			// todos are shown on the day they are due
+			startTime = endTime
 		}
-		day := time.Date(startTime.Year(), startTime.Month(), startTime.Day(), 0, 0, 0, 0, time.UTC)
+		startTime = startTime.In(loc)
+		endTime = endTime.In(loc)
 		data := eventData{
-			"title":    event.GetProperty("SUMMARY").Value,
-			"location": event.GetProperty("LOCATION").Value,
-			"start":    startTime,
-			"end":      endTime,
-			"id":       event.GetProperty("UID").Value,
-			"edit_url": edit_url.String(),
+			"title":      getPropertyValue(event, ics.ComponentPropertySummary),
+			"location":   getPropertyValue(event, ics.ComponentPropertyLocation),
+			"start":      startTime,
+			"end":        endTime,
+			"start_time": startTime.Format("15:04"),
+			"end_time":   endTime.Format("15:04"),
+			"allday":     allDay,
+			"id":         getItemId(event),
+		}
+		switch component.(type) {
+		case *ics.VEvent:
+			if editURL == nil {
+				break
+			}
+			// events without UID can't be edited
+			if edit_url, err := editURL(getItemId(event)); err == nil {
+				data["edit_url"] = edit_url.String()
+			} else {
+				log.Warnf("Event without valid UID: %s", err.Error())
+			}
+		case *ics.VTodo:
+			data["type"] = "todo"
+			data["completed"] = isCompleted(event)
+		case *ics.VJournal:
+			data["type"] = "journal"
 		}
 		description := event.GetProperty("DESCRIPTION")
 		if description != nil {
 			data["description"] = description.Value
 		}
+		var categories []string
+		for _, c := range getCategories(event) {
+			categories = append(categories, ics.FromText(c))
+		}
+		if len(categories) > 0 {
+			data["categories"] = categories
+		}
+		if color := getPropertyValue(event, ics.ComponentPropertyColor); color != "" {
+			data["color"] = color
+		}
+		if getPropertyValue(event, ics.ComponentPropertyStatus) == string(ics.ObjectStatusCancelled) {
+			data["cancelled"] = true
+		}
+		day := time.Date(startTime.Year(), startTime.Month(), startTime.Day(), 0, 0, 0, 0, loc)
 		calendarDataByDay[day.Format("2006-01-02")] = append(calendarDataByDay[day.Format("2006-01-02")], data)
+		if allDay {
+			// all-day events are shown on every day they span, the end date is exclusive
+			for day = day.AddDate(0, 0, 1); day.Format("2006-01-02") < endTime.Format("2006-01-02"); day = day.AddDate(0, 0, 1) {
+				calendarDataByDay[day.Format("2006-01-02")] = append(calendarDataByDay[day.Format("2006-01-02")], data)
+			}
+		}
 	}
 	return calendarDataByDay
 }
@@ -203,11 +283,24 @@ func profileHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
+	// the metadata may be inherited
+	profile, err := conf.resolveProfile(profile)
+	if err != nil {
+		requestLogger.Errorln(err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	// load params
-	time := r.URL.Query().Get("reminder")
-	if time != "" {
-		profile.Modules = append(profile.Modules, map[string]string{"name": "add-reminder", "time": time})
+	if reminder := r.URL.Query().Get("reminder"); reminder != "" {
+		trigger, err := parseLegacyReminder(reminder)
+		if err != nil {
+			requestLogger.Infoln(err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		// copy the modules, so the profile in the config isn't changed
+		profile.Modules = append(append([]map[string]string{}, profile.Modules...), map[string]string{"name": "alarm", "triggers": trigger.value})
 	}
 
 	calendar, err := getProfileCalendar(profile, vars["profile"])
@@ -216,6 +309,7 @@ func profileHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	setCalendarMetadata(calendar, profile, vars["profile"])
 	// return new calendar
 	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s.ics", vars["profile"]))
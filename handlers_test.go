@@ -0,0 +1,149 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func TestConflictsRouteOnlyGet(t *testing.T) {
+	oldRouter := router
+	defer func() { router = oldRouter }()
+	router = mux.NewRouter()
+	initHandlers()
+
+	for method, want := range map[string]int{
+		http.MethodPost:   http.StatusMethodNotAllowed,
+		http.MethodPut:    http.StatusMethodNotAllowed,
+		http.MethodDelete: http.StatusMethodNotAllowed,
+		// the handler itself answers, the profile doesn't exist
+		http.MethodGet: http.StatusNotFound,
+	} {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(method, "/api/profiles/missing/conflicts", nil))
+		if recorder.Code != want {
+			t.Errorf("%s conflicts = %d, want %d", method, recorder.Code, want)
+		}
+	}
+}
+
+func TestGetEventsByDay(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cal := testCalendar(t, `BEGIN:VEVENT
+UID:before-spring
+DTSTAMP:20240101T000000Z
+DTSTART:20240330T233000Z
+DTEND:20240331T003000Z
+SUMMARY:Nachts vor der Zeitumstellung
+END:VEVENT
+BEGIN:VEVENT
+UID:after-spring
+DTSTAMP:20240101T000000Z
+DTSTART:20240331T223000Z
+DTEND:20240331T233000Z
+SUMMARY:Erste Nacht der Sommerzeit
+END:VEVENT
+BEGIN:VEVENT
+UID:floating
+DTSTAMP:20240101T000000Z
+DTSTART:20240331T013000
+DTEND:20240331T033000
+SUMMARY:Ortszeit
+END:VEVENT
+BEGIN:VEVENT
+UID:autumn
+DTSTAMP:20240101T000000Z
+DTSTART:20241026T223000Z
+DTEND:20241026T233000Z
+SUMMARY:Letzte Nacht der Sommerzeit
+END:VEVENT
+BEGIN:VEVENT
+UID:after-autumn
+DTSTAMP:20240101T000000Z
+DTSTART:20241027T233000Z
+DTEND:20241028T003000Z
+SUMMARY:Erste Nacht der Winterzeit
+END:VEVENT
+BEGIN:VEVENT
+UID:allday
+DTSTAMP:20240101T000000Z
+DTSTART;VALUE=DATE:20240330
+DTEND;VALUE=DATE:20240402
+SUMMARY:Osterwochenende
+END:VEVENT
+BEGIN:VEVENT
+UID:allday-autumn
+DTSTAMP:20240101T000000Z
+DTSTART;VALUE=DATE:20241026
+DTEND;VALUE=DATE:20241028
+SUMMARY:Wochenende
+END:VEVENT
+BEGIN:VTODO
+UID:todo
+DTSTAMP:20240101T000000Z
+DTSTART:20240329T100000Z
+DUE:20240331T220000Z
+SUMMARY:Abgabe
+END:VTODO`)
+
+	// without a URL builder, events aren't linked
+	days := getEventsByDay(cal, berlin, nil)
+	want := map[string]string{
+		"2024-03-30": "allday",
+		"2024-03-31": "before-spring,floating,allday",
+		"2024-04-01": "after-spring,allday,todo",
+		"2024-10-26": "allday-autumn",
+		"2024-10-27": "autumn,allday-autumn",
+		"2024-10-28": "after-autumn",
+	}
+	var gotDays, wantDays []string
+	for day := range days {
+		gotDays = append(gotDays, day)
+	}
+	for day := range want {
+		wantDays = append(wantDays, day)
+	}
+	sort.Strings(gotDays)
+	sort.Strings(wantDays)
+	if strings.Join(gotDays, ",") != strings.Join(wantDays, ",") {
+		t.Errorf("getEventsByDay returned the days %v, want %v", gotDays, wantDays)
+	}
+	for day, ids := range want {
+		var got []string
+		for _, e := range days[day] {
+			got = append(got, e["id"].(string))
+			if _, ok := e["edit_url"]; ok {
+				t.Errorf("%s has an edit URL without URL builder", e["id"])
+			}
+		}
+		if strings.Join(got, ",") != ids {
+			t.Errorf("events on %s = %v, want %s", day, got, ids)
+		}
+	}
+	if start := days["2024-03-31"][1]["start_time"]; start != "01:30" {
+		t.Errorf("floating event starts at %s, want 01:30", start)
+	}
+	if start := days["2024-04-01"][0]["start_time"]; start != "00:30" {
+		t.Errorf("event after the change to summer time starts at %s, want 00:30", start)
+	}
+
+	editURL := func(uid string) (*url.URL, error) {
+		return url.Parse("/view/test/edit/" + uid)
+	}
+	days = getEventsByDay(cal, berlin, editURL)
+	if got := days["2024-03-31"][0]["edit_url"]; got != "/view/test/edit/before-spring" {
+		t.Errorf("edit URL = %v", got)
+	}
+	if _, ok := days["2024-04-01"][2]["edit_url"]; ok {
+		t.Error("todo got an edit URL")
+	}
+}
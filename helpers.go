@@ -1,12 +1,17 @@
 package main
 
 import (
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/mail"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	ics "github.com/arran4/golang-ical"
+	log "github.com/sirupsen/logrus"
 )
 
 func readCalURL(url string) (*ics.Calendar, error) {
@@ -16,7 +21,7 @@ func readCalURL(url string) (*ics.Calendar, error) {
 		return nil, err
 	}
 	// parse original calendar
-	return ics.ParseCalendar(response.Body)
+	return parseCalendar(response.Body)
 }
 
 func writeCalFile(cal *ics.Calendar, filename string) error {
@@ -32,7 +37,7 @@ func loadCalFile(filename string) (*ics.Calendar, error) {
 		return cal, err
 	}
 	// parse original calendar
-	cal, err = ics.ParseCalendar(file)
+	cal, err = parseCalendar(file)
 	if err != nil {
 		return cal, err
 	}
@@ -48,23 +53,31 @@ func directoryExists(filename string) bool {
 	return info.IsDir()
 }
 
-func prettyPrint(e ics.VEvent) string {
+// prettyPrint formats an event for notification mails. Times are shown in loc.
+func prettyPrint(e ics.VEvent, loc *time.Location) string {
 	var output string
-	output += e.GetProperty(ics.ComponentPropertySummary).Value + "\n"
+	output += getPropertyValue(&e.ComponentBase, ics.ComponentPropertySummary) + "\n"
 
-	start, err := e.GetStartAt()
+	start, end, allDay, err := getEventTimes(&e, loc)
+	start = start.In(loc)
+	end = end.In(loc)
 	if err != nil {
-		start, _ = e.GetAllDayStartAt()
-		output += start.Format("02. Jan 2006") + " - "
+		output += "Invalid time: " + err.Error() + "\n"
+	} else if allDay {
+		// the end of all-day events is exclusive, so the last day is the day before
+		lastDay := end.AddDate(0, 0, -1)
+		if !lastDay.After(start) {
+			output += start.Format("Mon 02. Jan 2006") + ", all-day\n"
+		} else {
+			output += start.Format("Mon 02. Jan 2006") + " - " + lastDay.Format("Mon 02. Jan 2006") + ", all-day\n"
+		}
 	} else {
 		output += start.Format("Mon 02. Jan 2006, 15:04") + " - "
-	}
-	end, err := e.GetEndAt()
-	if err != nil {
-		end, _ = e.GetAllDayEndAt()
-		output += end.Format("02. Jan 2006") + "\n"
-	} else {
-		output += end.Format("15:04") + "\n"
+		if start.Format("2006-01-02") == end.Format("2006-01-02") {
+			output += end.Format("15:04") + "\n"
+		} else {
+			output += end.Format("Mon 02. Jan 2006, 15:04") + "\n"
+		}
 	}
 
 	if e.GetProperty(ics.ComponentPropertyLocation) != nil {
@@ -87,20 +100,27 @@ func contains(s []string, str string) bool {
 	return false
 }
 
+func containsInt(s []int, i int) bool {
+	for _, v := range s {
+		if v == i {
+			return true
+		}
+	}
+	return false
+}
+
 // https://stackoverflow.com/a/66624104
 func validMail(email string) bool {
 	_, err := mail.ParseAddress(email)
 	return err == nil
 }
 
-// returns true, if a is in list b
-func stringInSlice(a string, list []string) bool {
-	for _, b := range list {
-		if b == a {
-			return true
-		}
+// returns the absolute value of d
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
 	}
-	return false
+	return d
 }
 
 // https://stackoverflow.com/a/37335777/9397749
@@ -112,3 +132,87 @@ func removeFromICS(slice []ics.Component, s int) []ics.Component {
 func removeFromMapString(slice []map[string]string, s int) []map[string]string {
 	return append(slice[:s], slice[s+1:]...)
 }
+
+// removes all properties with the given name from the component
+func removePropertyByName(component *ics.ComponentBase, property ics.ComponentProperty) {
+	for i := len(component.Properties) - 1; i >= 0; i-- {
+		if component.Properties[i].IANAToken == string(property) {
+			component.Properties = removeProperty(component.Properties, i)
+		}
+	}
+}
+
+// returns the value of the property or an empty string, if the property is not set
+func getPropertyValue(component *ics.ComponentBase, property ics.ComponentProperty) string {
+	p := component.GetProperty(property)
+	if p == nil {
+		return ""
+	}
+	return p.Value
+}
+
+// adds a category to the CATEGORIES property of the component, if it isn't already set
+func addCategory(component *ics.ComponentBase, category string) {
+	categories := getCategories(component)
+	if contains(categories, category) {
+		return
+	}
+	categories = append(categories, category)
+	removePropertyByName(component, ics.ComponentPropertyCategories)
+	component.AddProperty(ics.ComponentPropertyCategories, strings.Join(categories, ","))
+}
+
+// returns the categories of the component, CATEGORIES can be set multiple times and contain comma separated values
+func getCategories(component *ics.ComponentBase) []string {
+	var categories []string
+	for _, p := range component.Properties {
+		if p.IANAToken != string(ics.ComponentPropertyCategories) {
+			continue
+		}
+		for _, c := range strings.Split(p.Value, ",") {
+			if c = strings.TrimSpace(c); c != "" && !contains(categories, c) {
+				categories = append(categories, c)
+			}
+		}
+	}
+	return categories
+}
+
+// marks the event, todo or journal entry as cancelled, keeping its UID, so clients update their copy instead of keeping a stale one.
+// The SEQUENCE is increased and the summary is prefixed with prefix, if it isn't already.
+func cancelEvent(item *ics.ComponentBase, prefix string) {
+	if getPropertyValue(item, ics.ComponentPropertyStatus) == string(ics.ObjectStatusCancelled) {
+		return
+	}
+	item.SetProperty(ics.ComponentPropertyStatus, string(ics.ObjectStatusCancelled))
+	sequence, _ := strconv.Atoi(getPropertyValue(item, ics.ComponentPropertySequence))
+	item.SetProperty(ics.ComponentPropertySequence, strconv.Itoa(sequence+1))
+	summary := getPropertyValue(item, ics.ComponentPropertySummary)
+	if prefix = ics.ToText(prefix); prefix != "" && !strings.HasPrefix(summary, prefix) {
+		item.SetProperty(ics.ComponentPropertySummary, prefix+summary)
+	}
+}
+
+// checks the 'mode' parameter of the deletion modules: "delete" (default) removes the events, "cancel" keeps them
+// as cancelled events, see cancelEvent
+func checkDeleteMode(params map[string]string) error {
+	if params["mode"] != "" && params["mode"] != "delete" && params["mode"] != "cancel" {
+		return fmt.Errorf("invalid mode '%s', must be 'delete' or 'cancel'", params["mode"])
+	}
+	return nil
+}
+
+// removes the event, todo or journal entry at index i from the calendar, or cancels it with the 'prefix' parameter,
+// if 'mode' is "cancel". Returns the change of the number of events: -1 if it was removed, 0 if it was cancelled.
+func deleteOrCancelEvent(cal *ics.Calendar, i int, params map[string]string) int {
+	item := getItemBase(cal.Components[i])
+	itemType := getItemType(cal.Components[i])
+	if params["mode"] == "cancel" {
+		cancelEvent(item, params["prefix"])
+		log.Debug("Cancelled " + itemType + " with id " + getItemId(item) + "\n")
+		return 0
+	}
+	cal.Components = removeFromICS(cal.Components, i)
+	log.Debug("Excluding " + itemType + " with id " + getItemId(item) + "\n")
+	return -1
+}
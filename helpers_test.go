@@ -0,0 +1,85 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	ics "github.com/arran4/golang-ical"
+)
+
+const testCancelEvents = `BEGIN:VEVENT
+UID:lecture-1
+DTSTAMP:20240101T000000Z
+DTSTART:20241003T100000Z
+DTEND:20241003T120000Z
+SUMMARY:Vorlesung
+END:VEVENT
+BEGIN:VEVENT
+UID:lecture-2
+DTSTAMP:20240101T000000Z
+DTSTART:20241010T100000Z
+DTEND:20241010T120000Z
+SUMMARY:Übung
+SEQUENCE:2
+END:VEVENT`
+
+func TestCancelMode(t *testing.T) {
+	oldConf := conf
+	defer func() { conf = oldConf }()
+	conf.Periods = map[string]period{"feiertag": {From: "2024-10-03", Until: "2024-10-04"}}
+
+	tests := []struct {
+		module string
+		params map[string]string
+		want   string // UID of the only event that is cancelled
+	}{
+		{"delete-bysummary-regex", map[string]string{"regex": "^Vorlesung$"}, "lecture-1"},
+		{"delete-byid", map[string]string{"id": "lecture-2"}, "lecture-2"},
+		{"delete-timeframe", map[string]string{"after": "2024-10-05"}, "lecture-2"},
+		{"period", map[string]string{"period": "feiertag"}, "lecture-1"},
+		{"holidays", map[string]string{"country": "DE"}, "lecture-1"},
+		{"filter", map[string]string{"equals-SUMMARY": "Übung"}, "lecture-2"},
+		{"expression", map[string]string{"expression": `summary == "Übung"`}, "lecture-2"},
+	}
+	for _, test := range tests {
+		cal := testCalendar(t, testCancelEvents)
+		test.params["mode"] = "cancel"
+		test.params["prefix"] = "Entfällt: "
+		test.params["timezone"] = "UTC"
+		if validate, ok := moduleValidators[test.module]; ok {
+			if err := validate(test.params); err != nil {
+				t.Errorf("%s: invalid parameters: %v", test.module, err)
+				continue
+			}
+		}
+		count, err := callModule(modules[test.module], test.params, cal)
+		if err != nil || count != 0 || len(cal.Components) != 2 {
+			t.Errorf("%s with mode cancel = %d, %v, %d events left", test.module, count, err, len(cal.Components))
+			continue
+		}
+		for _, component := range cal.Components {
+			item := getItemBase(component)
+			status := getPropertyValue(item, ics.ComponentPropertyStatus)
+			summary := ics.FromText(getPropertyValue(item, ics.ComponentPropertySummary))
+			sequence := getPropertyValue(item, ics.ComponentPropertySequence)
+			if getItemId(item) != test.want {
+				if status != "" {
+					t.Errorf("%s: %s was cancelled, too", test.module, getItemId(item))
+				}
+				continue
+			}
+			wantSequence := "1"
+			if test.want == "lecture-2" {
+				wantSequence = "3"
+			}
+			if status != string(ics.ObjectStatusCancelled) || sequence != wantSequence || !strings.HasPrefix(summary, "Entfällt: ") {
+				t.Errorf("%s: cancelled event has STATUS %q, SEQUENCE %q and summary %q", test.module, status, sequence, summary)
+			}
+		}
+
+		test.params["mode"] = "invalid"
+		if _, err := callModule(modules[test.module], test.params, testCalendar(t, testCancelEvents)); err == nil {
+			t.Errorf("%s: expected an error for an invalid mode", test.module)
+		}
+	}
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	ics "github.com/arran4/golang-ical"
+	log "github.com/sirupsen/logrus"
+)
+
+type holiday struct {
+	Name string
+	Date time.Time // midnight UTC of the holiday
+}
+
+type holidayRule struct {
+	name   string
+	date   func(year int) time.Time
+	states []string // empty for nationwide holidays
+	since  int      // first year the holiday exists, 0 if always
+	until  int      // last year the holiday exists, 0 if still
+}
+
+// fixed date every year
+func fixedDate(month time.Month, day int) func(int) time.Time {
+	return func(year int) time.Time {
+		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	}
+}
+
+// days relative to easter sunday
+func easterOffset(days int) func(int) time.Time {
+	return func(year int) time.Time {
+		return easterSunday(year).AddDate(0, 0, days)
+	}
+}
+
+// n-th weekday of the month, n < 0 counts from the end of the month
+func nthWeekday(month time.Month, weekday time.Weekday, n int) func(int) time.Time {
+	return func(year int) time.Time {
+		if n > 0 {
+			first := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+			return first.AddDate(0, 0, (int(weekday)-int(first.Weekday())+7)%7+7*(n-1))
+		}
+		last := time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC)
+		return last.AddDate(0, 0, -((int(last.Weekday())-int(weekday)+7)%7)-7*(-n-1))
+	}
+}
+
+// last weekday strictly before the given date
+func weekdayBefore(month time.Month, day int, weekday time.Weekday) func(int) time.Time {
+	return func(year int) time.Time {
+		date := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+		diff := (int(date.Weekday()) - int(weekday) + 7) % 7
+		if diff == 0 {
+			diff = 7
+		}
+		return date.AddDate(0, 0, -diff)
+	}
+}
+
+// easterSunday calculates the date of easter sunday with the anonymous gregorian algorithm
+func easterSunday(year int) time.Time {
+	a := year % 19
+	b := year / 100
+	c := year % 100
+	d := b / 4
+	e := b % 4
+	f := (b + 8) / 25
+	g := (b - f + 1) / 3
+	h := (19*a + b - d - g + 15) % 30
+	i := c / 4
+	k := c % 4
+	l := (32 + 2*e + 2*i - h - k) % 7
+	m := (a + 11*h + 22*l) / 451
+	month := (h + l - 7*m + 114) / 31
+	day := (h+l-7*m+114)%31 + 1
+	return time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC)
+}
+
+// Holiday rules per country (ISO 3166-1 alpha-2). States use the ISO 3166-2 subdivision code without country prefix.
+// Only statutory holidays are listed. Regional holidays that apply only to parts of a state are left out,
+// as well as substitute days for holidays on weekends.
+var holidayRules = map[string][]holidayRule{
+	"DE": {
+		{name: "Neujahr", date: fixedDate(time.January, 1)},
+		{name: "Heilige Drei Könige", date: fixedDate(time.January, 6), states: []string{"BW", "BY", "ST"}},
+		{name: "Internationaler Frauentag", date: fixedDate(time.March, 8), states: []string{"BE"}, since: 2019},
+		{name: "Internationaler Frauentag", date: fixedDate(time.March, 8), states: []string{"MV"}, since: 2023},
+		{name: "Karfreitag", date: easterOffset(-2)},
+		{name: "Ostersonntag", date: easterOffset(0), states: []string{"BB"}},
+		{name: "Ostermontag", date: easterOffset(1)},
+		{name: "Tag der Arbeit", date: fixedDate(time.May, 1)},
+		{name: "Christi Himmelfahrt", date: easterOffset(39)},
+		{name: "Pfingstsonntag", date: easterOffset(49), states: []string{"BB"}},
+		{name: "Pfingstmontag", date: easterOffset(50)},
+		{name: "Fronleichnam", date: easterOffset(60), states: []string{"BW", "BY", "HE", "NW", "RP", "SL"}},
+		{name: "Mariä Himmelfahrt", date: fixedDate(time.August, 15), states: []string{"SL"}},
+		{name: "Weltkindertag", date: fixedDate(time.September, 20), states: []string{"TH"}, since: 2019},
+		{name: "Tag der Deutschen Einheit", date: fixedDate(time.October, 3), since: 1990},
+		{name: "Reformationstag", date: fixedDate(time.October, 31), states: []string{"BB", "MV", "SN", "ST", "TH"}},
+		{name: "Reformationstag", date: fixedDate(time.October, 31), states: []string{"HB", "HH", "NI", "SH"}, since: 2018},
+		{name: "Reformationstag", date: fixedDate(time.October, 31), since: 2017, until: 2017},
+		{name: "Allerheiligen", date: fixedDate(time.November, 1), states: []string{"BW", "BY", "NW", "RP", "SL"}},
+		{name: "Buß- und Bettag", date: weekdayBefore(time.November, 23, time.Wednesday), states: []string{"SN"}},
+		{name: "1. Weihnachtsfeiertag", date: fixedDate(time.December, 25)},
+		{name: "2. Weihnachtsfeiertag", date: fixedDate(time.December, 26)},
+	},
+	"AT": {
+		{name: "Neujahr", date: fixedDate(time.January, 1)},
+		{name: "Heilige Drei Könige", date: fixedDate(time.January, 6)},
+		{name: "Ostermontag", date: easterOffset(1)},
+		{name: "Staatsfeiertag", date: fixedDate(time.May, 1)},
+		{name: "Christi Himmelfahrt", date: easterOffset(39)},
+		{name: "Pfingstmontag", date: easterOffset(50)},
+		{name: "Fronleichnam", date: easterOffset(60)},
+		{name: "Mariä Himmelfahrt", date: fixedDate(time.August, 15)},
+		{name: "Nationalfeiertag", date: fixedDate(time.October, 26)},
+		{name: "Allerheiligen", date: fixedDate(time.November, 1)},
+		{name: "Mariä Empfängnis", date: fixedDate(time.December, 8)},
+		{name: "Christtag", date: fixedDate(time.December, 25)},
+		{name: "Stefanitag", date: fixedDate(time.December, 26)},
+	},
+	"CH": {
+		{name: "Neujahr", date: fixedDate(time.January, 1)},
+		{name: "Karfreitag", date: easterOffset(-2)},
+		{name: "Ostermontag", date: easterOffset(1)},
+		{name: "Auffahrt", date: easterOffset(39)},
+		{name: "Pfingstmontag", date: easterOffset(50)},
+		{name: "Bundesfeier", date: fixedDate(time.August, 1)},
+		{name: "Weihnachten", date: fixedDate(time.December, 25)},
+		{name: "Stephanstag", date: fixedDate(time.December, 26)},
+	},
+	"FR": {
+		{name: "Jour de l'an", date: fixedDate(time.January, 1)},
+		{name: "Lundi de Pâques", date: easterOffset(1)},
+		{name: "Fête du Travail", date: fixedDate(time.May, 1)},
+		{name: "Victoire 1945", date: fixedDate(time.May, 8)},
+		{name: "Ascension", date: easterOffset(39)},
+		{name: "Lundi de Pentecôte", date: easterOffset(50)},
+		{name: "Fête nationale", date: fixedDate(time.July, 14)},
+		{name: "Assomption", date: fixedDate(time.August, 15)},
+		{name: "Toussaint", date: fixedDate(time.November, 1)},
+		{name: "Armistice 1918", date: fixedDate(time.November, 11)},
+		{name: "Noël", date: fixedDate(time.December, 25)},
+	},
+	"US": {
+		{name: "New Year's Day", date: fixedDate(time.January, 1)},
+		{name: "Martin Luther King Jr. Day", date: nthWeekday(time.January, time.Monday, 3), since: 1986},
+		{name: "Washington's Birthday", date: nthWeekday(time.February, time.Monday, 3)},
+		{name: "Memorial Day", date: nthWeekday(time.May, time.Monday, -1)},
+		{name: "Juneteenth", date: fixedDate(time.June, 19), since: 2021},
+		{name: "Independence Day", date: fixedDate(time.July, 4)},
+		{name: "Labor Day", date: nthWeekday(time.September, time.Monday, 1)},
+		{name: "Columbus Day", date: nthWeekday(time.October, time.Monday, 2)},
+		{name: "Veterans Day", date: fixedDate(time.November, 11)},
+		{name: "Thanksgiving Day", date: nthWeekday(time.November, time.Thursday, 4)},
+		{name: "Christmas Day", date: fixedDate(time.December, 25)},
+	},
+}
+
+// getHolidays returns all holidays of the country and state in the year, sorted by date.
+// state may be empty to only get the nationwide holidays.
+func getHolidays(country string, state string, year int) ([]holiday, error) {
+	rules, ok := holidayRules[strings.ToUpper(country)]
+	if !ok {
+		return nil, fmt.Errorf("no holiday rules for country '%s'", country)
+	}
+	state = strings.ToUpper(state)
+	var holidays []holiday
+	seen := make(map[string]bool)
+	for _, rule := range rules {
+		if (rule.since != 0 && year < rule.since) || (rule.until != 0 && year > rule.until) {
+			continue
+		}
+		if len(rule.states) > 0 && !contains(rule.states, state) {
+			continue
+		}
+		date := rule.date(year)
+		key := date.Format("2006-01-02") + rule.name
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		holidays = append(holidays, holiday{Name: rule.name, Date: date})
+	}
+	sort.SliceStable(holidays, func(i, j int) bool {
+		return holidays[i].Date.Before(holidays[j].Date)
+	})
+	return holidays, nil
+}
+
+// getHolidayMap returns the holidays of all given years, mapped by their date ("2006-01-02").
+// If multiple holidays are on the same day, their names are joined.
+func getHolidayMap(country string, state string, years []int) (map[string]string, error) {
+	holidayMap := make(map[string]string)
+	for _, year := range years {
+		holidays, err := getHolidays(country, state, year)
+		if err != nil {
+			return nil, err
+		}
+		for _, h := range holidays {
+			day := h.Date.Format("2006-01-02")
+			if holidayMap[day] != "" {
+				holidayMap[day] += ", " + h.Name
+			} else {
+				holidayMap[day] = h.Name
+			}
+		}
+	}
+	return holidayMap, nil
+}
+
+// This module handles events, todos and journal entries on public holidays. The holidays are calculated offline from rules.
+// Todos without DTSTART are on the day of DUE, todos and journal entries without any date are skipped.
+// Parameters:
+// - 'country', mandatory: ISO 3166-1 code of the country, e.g. "DE"
+// - 'state', optional: ISO 3166-2 code of the state without country, e.g. "BW". Without it, only nationwide holidays are used
+// - 'action', default "delete": what to do with events on holidays:
+//   - "delete": remove the event, or cancel it with 'mode' "cancel"
+//   - "annotate": prefix the summary with the name of the holiday in brackets
+//   - "none": leave the events unchanged, useful with 'add-holidays'
+//
+// - 'mode', default "delete": with action "delete", "delete" removes the events, "cancel" keeps them with STATUS:CANCELLED
+// and an increased SEQUENCE
+// - 'regex', optional: only events whose summary matches are handled
+// - 'prefix', optional: text prepended to the summary of cancelled events
+// - 'add-holidays', default false: if "true", the holidays are added as all-day events for all years with events
+// Returns the number of events removed or added.
+func moduleHolidays(cal *ics.Calendar, params map[string]string) (int, error) {
+	var count int
+	if params["country"] == "" {
+		return 0, fmt.Errorf("missing mandatory Parameter 'country'")
+	}
+	if params["action"] == "" {
+		params["action"] = "delete"
+	}
+	if !contains([]string{"delete", "annotate", "none"}, params["action"]) {
+		return 0, fmt.Errorf("invalid action '%s', must be 'delete', 'annotate' or 'none'", params["action"])
+	}
+	if err := checkDeleteMode(params); err != nil {
+		return 0, err
+	}
+	var re *regexp.Regexp
+	if params["regex"] != "" {
+		var err error
+		re, err = regexp.Compile(params["regex"])
+		if err != nil {
+			return 0, fmt.Errorf("invalid regex: %s", err.Error())
+		}
+	}
+	loc, err := getParamLocation(params)
+	if err != nil {
+		return 0, err
+	}
+
+	// collect the years of all events to calculate the holidays only once
+	var years []int
+	for _, component := range cal.Components {
+		start, _, _, err := getItemTimes(component, loc)
+		if err == nil && !containsInt(years, start.In(loc).Year()) {
+			years = append(years, start.In(loc).Year())
+		}
+	}
+	if len(years) == 0 {
+		years = []int{time.Now().In(loc).Year()}
+	}
+	holidayMap, err := getHolidayMap(params["country"], params["state"], years)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := len(cal.Components) - 1; i >= 0; i-- { // iterate over events backwards
+		item := getItemBase(cal.Components[i])
+		if item == nil {
+			continue
+		}
+		start, _, _, err := getItemTimes(cal.Components[i], loc)
+		if err == errUndated {
+			continue
+		}
+		if err != nil {
+			log.Warnf("Skipping event: %s", err.Error())
+			continue
+		}
+		name, ok := holidayMap[start.In(loc).Format("2006-01-02")]
+		if !ok {
+			continue
+		}
+		summary := getPropertyValue(item, ics.ComponentPropertySummary)
+		if re != nil && !re.MatchString(summary) {
+			continue
+		}
+		switch params["action"] {
+		case "delete":
+			log.Debug("Holiday " + name + " on " + getItemType(cal.Components[i]) + " with id " + getItemId(item) + "\n")
+			count += deleteOrCancelEvent(cal, i, params)
+		case "annotate":
+			item.SetProperty(ics.ComponentPropertySummary, ics.ToText("["+name+"] ")+summary)
+			log.Debug("Annotated " + getItemType(cal.Components[i]) + " with id " + getItemId(item) + " on holiday " + name + "\n")
+		}
+	}
+
+	if params["add-holidays"] == "true" {
+		for _, year := range years {
+			holidays, err := getHolidays(params["country"], params["state"], year)
+			if err != nil {
+				return count, err
+			}
+			for _, h := range holidays {
+				uid := fmt.Sprintf("holiday-%s-%s-%s@ical-relay", strings.ToLower(params["country"]), strings.ToLower(params["state"]), h.Date.Format("20060102"))
+				event := cal.AddEvent(uid)
+				event.SetSummary(h.Name)
+				event.SetDtStampTime(time.Now())
+				event.SetTimeTransparency(ics.TransparencyTransparent)
+				addCategory(&event.ComponentBase, "Holiday")
+				setEventTimes(event, h.Date, h.Date.AddDate(0, 0, 1), true)
+				count++
+			}
+		}
+		log.Debugf("Added holidays of %v\n", years)
+	}
+	return count, nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	ics "github.com/arran4/golang-ical"
+)
+
+func TestEasterSunday(t *testing.T) {
+	tests := map[int]string{
+		1818: "1818-03-22",
+		1943: "1943-04-25",
+		2000: "2000-04-23",
+		2008: "2008-03-23",
+		2011: "2011-04-24",
+		2019: "2019-04-21",
+		2020: "2020-04-12",
+		2023: "2023-04-09",
+		2024: "2024-03-31",
+		2025: "2025-04-20",
+		2026: "2026-04-05",
+		2038: "2038-04-25",
+	}
+	for year, want := range tests {
+		if got := easterSunday(year).Format("2006-01-02"); got != want {
+			t.Errorf("easterSunday(%d) = %s, want %s", year, got, want)
+		}
+	}
+}
+
+func TestGetHolidays(t *testing.T) {
+	tests := []struct {
+		country string
+		state   string
+		year    int
+		date    string
+		name    string // empty if there must be no holiday on the date
+	}{
+		// fixed dates
+		{"DE", "", 2024, "2024-01-01", "Neujahr"},
+		{"DE", "", 2024, "2024-10-03", "Tag der Deutschen Einheit"},
+		{"DE", "BW", 2024, "2024-01-06", "Heilige Drei Könige"},
+		{"DE", "NI", 2024, "2024-01-06", ""},
+		{"AT", "", 2025, "2025-10-26", "Nationalfeiertag"},
+		{"FR", "", 2023, "2023-07-14", "Fête nationale"},
+		// easter based
+		{"DE", "", 2024, "2024-03-29", "Karfreitag"},
+		{"DE", "", 2024, "2024-04-01", "Ostermontag"},
+		{"DE", "", 2024, "2024-05-09", "Christi Himmelfahrt"},
+		{"DE", "", 2024, "2024-05-20", "Pfingstmontag"},
+		{"DE", "BW", 2024, "2024-05-30", "Fronleichnam"},
+		{"DE", "HH", 2024, "2024-05-30", ""},
+		{"DE", "BB", 2025, "2025-04-20", "Ostersonntag"},
+		{"CH", "", 2023, "2023-05-18", "Auffahrt"},
+		{"FR", "", 2025, "2025-06-09", "Lundi de Pentecôte"},
+		// weekday based
+		{"DE", "SN", 2022, "2022-11-16", "Buß- und Bettag"},
+		{"DE", "SN", 2023, "2023-11-22", "Buß- und Bettag"},
+		{"DE", "SN", 2024, "2024-11-20", "Buß- und Bettag"},
+		{"US", "", 2024, "2024-01-15", "Martin Luther King Jr. Day"},
+		{"US", "", 2023, "2023-05-29", "Memorial Day"},
+		{"US", "", 2024, "2024-05-27", "Memorial Day"},
+		{"US", "", 2024, "2024-09-02", "Labor Day"},
+		{"US", "", 2023, "2023-11-23", "Thanksgiving Day"},
+		{"US", "", 2024, "2024-11-28", "Thanksgiving Day"},
+		// holidays limited to some years
+		{"DE", "BW", 2017, "2017-10-31", "Reformationstag"},
+		{"DE", "BW", 2018, "2018-10-31", ""},
+		{"DE", "HH", 2018, "2018-10-31", "Reformationstag"},
+		{"DE", "BE", 2018, "2018-03-08", ""},
+		{"DE", "BE", 2019, "2019-03-08", "Internationaler Frauentag"},
+		{"US", "", 2020, "2020-06-19", ""},
+		{"US", "", 2021, "2021-06-19", "Juneteenth"},
+		// country and state are case-insensitive
+		{"de", "by", 2024, "2024-08-15", ""},
+		{"de", "sl", 2024, "2024-08-15", "Mariä Himmelfahrt"},
+	}
+	for _, test := range tests {
+		holidays, err := getHolidays(test.country, test.state, test.year)
+		if err != nil {
+			t.Errorf("getHolidays(%s, %s, %d): unexpected error: %v", test.country, test.state, test.year, err)
+			continue
+		}
+		var got string
+		for _, h := range holidays {
+			if h.Date.Format("2006-01-02") == test.date {
+				got = h.Name
+			}
+		}
+		if got != test.name {
+			t.Errorf("getHolidays(%s, %s, %d) on %s = %q, want %q", test.country, test.state, test.year, test.date, got, test.name)
+		}
+	}
+}
+
+func TestGetHolidaysSorted(t *testing.T) {
+	holidays, err := getHolidays("DE", "", 2024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"Neujahr", "Karfreitag", "Ostermontag", "Tag der Arbeit", "Christi Himmelfahrt", "Pfingstmontag",
+		"Tag der Deutschen Einheit", "1. Weihnachtsfeiertag", "2. Weihnachtsfeiertag"}
+	if len(holidays) != len(want) {
+		t.Fatalf("getHolidays(DE, 2024) returned %d holidays, want %d: %v", len(holidays), len(want), holidays)
+	}
+	for i, h := range holidays {
+		if h.Name != want[i] {
+			t.Errorf("holiday %d = %s, want %s", i, h.Name, want[i])
+		}
+		if h.Date.Location() != time.UTC || h.Date.Hour() != 0 {
+			t.Errorf("holiday %s is not at midnight UTC: %v", h.Name, h.Date)
+		}
+	}
+
+	if _, err := getHolidays("XX", "", 2024); err == nil {
+		t.Error("expected an error for an unknown country")
+	}
+}
+
+func TestModuleHolidaysAnnotate(t *testing.T) {
+	// Tag der Arbeit and Christi Himmelfahrt are both on 2008-05-01
+	cal := testCalendar(t, `BEGIN:VEVENT
+UID:lecture-1
+DTSTAMP:20080101T000000Z
+DTSTART:20080501T100000Z
+DTEND:20080501T120000Z
+SUMMARY:Lecture\, Part 1
+END:VEVENT`)
+	count, err := moduleHolidays(cal, map[string]string{"country": "DE", "action": "annotate", "timezone": "UTC"})
+	if err != nil || count != 0 {
+		t.Fatalf("moduleHolidays = %d, %v", count, err)
+	}
+	item := getItemBase(cal.Components[0])
+	if got := getPropertyValue(item, ics.ComponentPropertySummary); got != `[Tag der Arbeit\, Christi Himmelfahrt] Lecture\, Part 1` {
+		t.Errorf("annotated SUMMARY = %q", got)
+	}
+	if got := ics.FromText(getPropertyValue(item, ics.ComponentPropertySummary)); got != "[Tag der Arbeit, Christi Himmelfahrt] Lecture, Part 1" {
+		t.Errorf("annotated summary = %q", got)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	ics "github.com/arran4/golang-ical"
+)
+
+// Besides events, calendars may contain todos (VTODO) and journal entries (VJOURNAL). Together they are called items here.
+// Todos are dated by DTSTART and DUE, journal entries only by DTSTART. Both may have no date at all.
+
+// errUndated is returned by getItemTimes for todos and journal entries without any date
+var errUndated = errors.New("no DTSTART or DUE")
+
+// getItemBase returns the ComponentBase of an event, todo or journal entry.
+// Returns nil for other components, e.g. VTIMEZONE.
+func getItemBase(component ics.Component) *ics.ComponentBase {
+	switch c := component.(type) {
+	case *ics.VEvent:
+		return &c.ComponentBase
+	case *ics.VTodo:
+		return &c.ComponentBase
+	case *ics.VJournal:
+		return &c.ComponentBase
+	}
+	return nil
+}
+
+// getItemId returns the UID of an event, todo or journal entry
+func getItemId(item *ics.ComponentBase) string {
+	return getPropertyValue(item, ics.ComponentPropertyUniqueId)
+}
+
+// getItemType returns "event", "todo" or "journal"
+func getItemType(component ics.Component) string {
+	switch component.(type) {
+	case *ics.VTodo:
+		return "todo"
+	case *ics.VJournal:
+		return "journal"
+	}
+	return "event"
+}
+
+// countItems returns the number of events, todos and journal entries of the calendar
+func countItems(cal *ics.Calendar) int {
+	var count int
+	for _, component := range cal.Components {
+		if getItemBase(component) != nil {
+			count++
+		}
+	}
+	return count
+}
+
+// getItemTimes returns the start and end of an event, todo or journal entry and whether it is all-day, see getEventTimes.
+// Todos start at DTSTART and end at DUE. Without DUE, the end is calculated from DURATION. Without DTSTART, they start at DUE.
+// Journal entries start at DTSTART and last one day for dates, otherwise they end at their start.
+// Todos and journal entries without a date return errUndated.
+func getItemTimes(component ics.Component, loc *time.Location) (time.Time, time.Time, bool, error) {
+	switch c := component.(type) {
+	case *ics.VEvent:
+		return getEventTimes(c, loc)
+	case *ics.VTodo:
+		startProp := c.GetProperty(ics.ComponentPropertyDtStart)
+		dueProp := c.GetProperty(ics.ComponentProperty(ics.PropertyDue))
+		if startProp == nil && dueProp == nil {
+			return time.Time{}, time.Time{}, false, errUndated
+		}
+		var due time.Time
+		var allDay bool
+		var err error
+		if dueProp != nil {
+			due, allDay, err = parseICalTime(dueProp, loc)
+			if err != nil {
+				return time.Time{}, time.Time{}, false, fmt.Errorf("invalid DUE of todo %s: %s", getItemId(&c.ComponentBase), err.Error())
+			}
+			if startProp == nil {
+				return due, due, allDay, nil
+			}
+		}
+		start, allDay, err := parseICalTime(startProp, loc)
+		if err != nil {
+			return time.Time{}, time.Time{}, false, fmt.Errorf("invalid DTSTART of todo %s: %s", getItemId(&c.ComponentBase), err.Error())
+		}
+		if dueProp != nil {
+			return start, due, allDay, nil
+		}
+		if durationProp := c.GetProperty(ics.ComponentProperty(ics.PropertyDuration)); durationProp != nil {
+			duration, err := parseICalDuration(durationProp.Value)
+			if err != nil {
+				return start, start, allDay, fmt.Errorf("invalid DURATION of todo %s: %s", getItemId(&c.ComponentBase), err.Error())
+			}
+			return start, start.Add(duration), allDay, nil
+		}
+		return start, start, allDay, nil
+	case *ics.VJournal:
+		startProp := c.GetProperty(ics.ComponentPropertyDtStart)
+		if startProp == nil {
+			return time.Time{}, time.Time{}, false, errUndated
+		}
+		start, allDay, err := parseICalTime(startProp, loc)
+		if err != nil {
+			return time.Time{}, time.Time{}, false, fmt.Errorf("invalid DTSTART of journal entry %s: %s", getItemId(&c.ComponentBase), err.Error())
+		}
+		if allDay {
+			return start, start.AddDate(0, 0, 1), allDay, nil
+		}
+		return start, start, allDay, nil
+	}
+	return time.Time{}, time.Time{}, false, fmt.Errorf("unsupported component %T", component)
+}
+
+// setItemTimes sets the start and end of an event, todo or journal entry, see setEventTimes.
+// Todos get DTSTART and DUE, but todos with only one of them keep it that way, if start and end are equal.
+// Journal entries only have a start.
+func setItemTimes(component ics.Component, start time.Time, end time.Time, allDay bool) {
+	switch c := component.(type) {
+	case *ics.VEvent:
+		setEventTimes(c, start, end, allDay)
+	case *ics.VTodo:
+		hasStart := c.GetProperty(ics.ComponentPropertyDtStart) != nil
+		hasEnd := c.GetProperty(ics.ComponentProperty(ics.PropertyDue)) != nil || c.GetProperty(ics.ComponentProperty(ics.PropertyDuration)) != nil
+		if hasStart || !start.Equal(end) {
+			setTimeProperty(&c.ComponentBase, ics.ComponentPropertyDtStart, start, allDay)
+		}
+		if hasEnd || !hasStart || !start.Equal(end) {
+			setTimeProperty(&c.ComponentBase, ics.ComponentProperty(ics.PropertyDue), end, allDay)
+		}
+		removePropertyByName(&c.ComponentBase, ics.ComponentProperty(ics.PropertyDuration))
+	case *ics.VJournal:
+		setTimeProperty(&c.ComponentBase, ics.ComponentPropertyDtStart, start, allDay)
+	}
+}
+
+// setTimeProperty sets a DATE value for all-day items, or a DATE-TIME value in UTC
+func setTimeProperty(item *ics.ComponentBase, property ics.ComponentProperty, t time.Time, allDay bool) {
+	if allDay {
+		item.SetProperty(property, t.Format(icalDateFormat), ics.WithValue(string(ics.ValueDataTypeDate)))
+	} else {
+		item.SetProperty(property, t.UTC().Format(icalDateTimeFormatUTC))
+	}
+}
+
+// isCompleted returns true, if the todo has STATUS:COMPLETED or a COMPLETED time
+func isCompleted(item *ics.ComponentBase) bool {
+	return getPropertyValue(item, ics.ComponentPropertyStatus) == string(ics.ObjectStatusCompleted) ||
+		item.GetProperty(ics.ComponentProperty(ics.PropertyCompleted)) != nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	ics "github.com/arran4/golang-ical"
+)
+
+const testItems = `BEGIN:VTODO
+UID:todo-1
+DTSTAMP:20240101T000000Z
+DTSTART:20241003T080000Z
+DUE:20241003T100000Z
+SUMMARY:Abgabe
+DESCRIPTION:<p>Blatt 1</p>
+END:VTODO
+BEGIN:VTODO
+UID:todo-2
+DTSTAMP:20240101T000000Z
+DUE:20241104T100000Z
+SUMMARY:Klausur anmelden
+END:VTODO
+BEGIN:VTODO
+UID:todo-3
+DTSTAMP:20240101T000000Z
+SUMMARY:Irgendwann
+END:VTODO
+BEGIN:VJOURNAL
+UID:journal-1
+DTSTAMP:20240101T000000Z
+DTSTART;VALUE=DATE:20241003
+SUMMARY:Protokoll
+END:VJOURNAL`
+
+// itemSummaries returns the summaries of all items by UID
+func itemSummaries(cal *ics.Calendar) map[string]string {
+	summaries := make(map[string]string)
+	for _, component := range cal.Components {
+		if item := getItemBase(component); item != nil {
+			summaries[getItemId(item)] = ics.FromText(getPropertyValue(item, ics.ComponentPropertySummary))
+		}
+	}
+	return summaries
+}
+
+func TestModulesHandleTodosAndJournals(t *testing.T) {
+	oldConf := conf
+	defer func() { conf = oldConf }()
+	conf.Periods = map[string]period{"oktober": {From: "2024-10-01", Until: "2024-11-01"}}
+
+	cal := testCalendar(t, testItems)
+	count, err := modulePeriod(cal, map[string]string{"period": "oktober", "action": "tag", "prefix": "[Okt] ", "timezone": "UTC"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	summaries := itemSummaries(cal)
+	if count != 0 || summaries["todo-1"] != "[Okt] Abgabe" || summaries["journal-1"] != "[Okt] Protokoll" ||
+		summaries["todo-2"] != "Klausur anmelden" || summaries["todo-3"] != "Irgendwann" {
+		t.Errorf("period tagged %v", summaries)
+	}
+	cal = testCalendar(t, testItems)
+	if count, err = modulePeriod(cal, map[string]string{"period": "oktober", "invert": "true", "timezone": "UTC"}); err != nil || count != -2 {
+		t.Errorf("period with invert removed %d items: %v", -count, err)
+	}
+
+	cal = testCalendar(t, testItems)
+	if count, err = moduleHolidays(cal, map[string]string{"country": "DE", "action": "annotate", "timezone": "UTC"}); err != nil || count != 0 {
+		t.Fatalf("holidays = %d, %v", count, err)
+	}
+	summaries = itemSummaries(cal)
+	if summaries["todo-1"] != "[Tag der Deutschen Einheit] Abgabe" || summaries["journal-1"] != "[Tag der Deutschen Einheit] Protokoll" ||
+		summaries["todo-2"] != "Klausur anmelden" {
+		t.Errorf("holidays annotated %v", summaries)
+	}
+
+	cal = testCalendar(t, testItems)
+	if _, err = moduleTemplate(cal, map[string]string{"set-SUMMARY": "{{.Type}}: {{.Summary}}{{if not .Start.IsZero}} ({{date \"02.01.\" .Start}}){{end}}", "timezone": "UTC"}); err != nil {
+		t.Fatal(err)
+	}
+	summaries = itemSummaries(cal)
+	if summaries["todo-1"] != "todo: Abgabe (03.10.)" || summaries["todo-3"] != "todo: Irgendwann" || summaries["journal-1"] != "journal: Protokoll (03.10.)" {
+		t.Errorf("template wrote %v", summaries)
+	}
+
+	cal = testCalendar(t, testItems)
+	if _, err = moduleSanitize(cal, map[string]string{}); err != nil {
+		t.Fatal(err)
+	}
+	if description := ics.FromText(getPropertyValue(getItemBase(cal.Components[0]), ics.ComponentPropertyDescription)); description != "Blatt 1" {
+		t.Errorf("sanitized description of todo = %q", description)
+	}
+
+	cal = testCalendar(t, testItems)
+	if _, err = moduleAlarm(cal, map[string]string{"triggers": "1h,2024-10-01T08:00:00", "timezone": "UTC"}); err != nil {
+		t.Fatal(err)
+	}
+	serialized := cal.Serialize()
+	for _, want := range []string{
+		"UID:todo-1\r\n",
+		"TRIGGER:-PT1H\r\n",
+		"TRIGGER;RELATED=END:-PT1H\r\n",
+		"TRIGGER;VALUE=DATE-TIME:20241001T080000Z\r\n",
+	} {
+		if !strings.Contains(serialized, want) {
+			t.Errorf("calendar with alarms doesn't contain %q:\n%s", want, serialized)
+		}
+	}
+	alarms := make(map[string]int)
+	for _, component := range cal.Components {
+		for _, c := range getItemBase(component).Components {
+			if _, ok := c.(*ics.VAlarm); ok {
+				alarms[getItemId(getItemBase(component))]++
+			}
+		}
+	}
+	if alarms["todo-1"] != 2 || alarms["todo-2"] != 2 || alarms["todo-3"] != 1 || alarms["journal-1"] != 0 {
+		t.Errorf("alarms per item = %v", alarms)
+	}
+}
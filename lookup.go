@@ -0,0 +1,261 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	ics "github.com/arran4/golang-ical"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+type lookupEntry struct {
+	key   string
+	value string
+	regex *regexp.Regexp
+}
+
+// parseLookupTable parses a lookup table in CSV ("key,value" per line) or YAML (a mapping of keys to values) format.
+// The order of the entries is kept, since the first matching regex key wins.
+func parseLookupTable(data string, format string) ([]lookupEntry, error) {
+	var entries []lookupEntry
+	switch format {
+	case "csv":
+		r := csv.NewReader(strings.NewReader(data))
+		r.Comment = '#'
+		r.FieldsPerRecord = -1
+		r.TrimLeadingSpace = true
+		records, err := r.ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %s", err.Error())
+		}
+		for i, record := range records {
+			if len(record) != 2 {
+				return nil, fmt.Errorf("invalid CSV: line %d has %d fields instead of 2 (key,value)", i+1, len(record))
+			}
+			entries = append(entries, lookupEntry{key: record[0], value: record[1]})
+		}
+	case "yaml":
+		// decode into a node to keep the order of the keys
+		var node yaml.Node
+		err := yaml.Unmarshal([]byte(data), &node)
+		if err != nil {
+			return nil, fmt.Errorf("invalid YAML: %s", err.Error())
+		}
+		if len(node.Content) == 0 {
+			return nil, nil
+		}
+		mapping := node.Content[0]
+		if mapping.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("invalid YAML: the table has to be a mapping of keys to values")
+		}
+		for i := 0; i+1 < len(mapping.Content); i += 2 {
+			if mapping.Content[i+1].Kind != yaml.ScalarNode {
+				return nil, fmt.Errorf("invalid YAML: value of '%s' is not a string", mapping.Content[i].Value)
+			}
+			entries = append(entries, lookupEntry{key: mapping.Content[i].Value, value: mapping.Content[i+1].Value})
+		}
+	default:
+		return nil, fmt.Errorf("invalid format '%s', must be 'csv' or 'yaml'", format)
+	}
+	return entries, nil
+}
+
+// maximum size of uploaded lookup tables
+const maxTableSize = 1 << 20
+
+// matches the names of uploaded lookup tables, the extension sets the format
+var tableNameRegex = regexp.MustCompile(`^[A-Za-z0-9_-]+\.(csv|yml|yaml)$`)
+
+// getTableDir returns the directory of the lookup tables uploaded for the profile
+func getTableDir(profileName string) string {
+	return conf.Server.StoragePath + "tablestore/" + profileName + "/"
+}
+
+// splitTableUpload splits the 'upload' parameter of the map module ("<profile>/<name>") into profile and table name
+func splitTableUpload(upload string) (string, string, error) {
+	parts := strings.SplitN(upload, "/", 2)
+	if len(parts) != 2 || !conf.profileExists(parts[0]) || !tableNameRegex.MatchString(parts[1]) {
+		return "", "", fmt.Errorf("invalid uploaded table '%s', must be '<profile>/<name>' of an uploaded table", upload)
+	}
+	return parts[0], parts[1], nil
+}
+
+// getTableFormat returns the format of a lookup table file by its extension
+func getTableFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yml", ".yaml":
+		return "yaml"
+	}
+	return "csv"
+}
+
+// listTables returns the names of the lookup tables uploaded for the profile
+func listTables(profileName string) ([]string, error) {
+	tables := []string{}
+	files, err := ioutil.ReadDir(getTableDir(profileName))
+	if os.IsNotExist(err) {
+		return tables, nil
+	} else if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		if tableNameRegex.MatchString(f.Name()) {
+			tables = append(tables, f.Name())
+		}
+	}
+	return tables, nil
+}
+
+// saveTable checks and stores an uploaded lookup table of the profile
+func saveTable(profileName string, name string, data []byte) error {
+	if !tableNameRegex.MatchString(name) {
+		return fmt.Errorf("invalid table name '%s', must be letters, digits, '-' or '_' and end in .csv, .yml or .yaml", name)
+	}
+	if _, err := parseLookupTable(string(data), getTableFormat(name)); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(getTableDir(profileName), 0750); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(getTableDir(profileName)+name, data, 0600)
+}
+
+// loadLookupTable reads the table of the map module from the parameters 'file', 'upload' or 'table', and prepares it for the match mode.
+func loadLookupTable(params map[string]string) ([]lookupEntry, error) {
+	var sources int
+	for _, param := range []string{"file", "upload", "table"} {
+		if params[param] != "" {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return nil, fmt.Errorf("exactly one of the parameters 'file', 'upload' and 'table' is mandatory")
+	}
+	data := params["table"]
+	format := params["format"]
+	path := params["file"]
+	if params["upload"] != "" {
+		profileName, name, err := splitTableUpload(params["upload"])
+		if err != nil {
+			return nil, err
+		}
+		path = getTableDir(profileName) + name
+	}
+	if path != "" {
+		content, err := ioutil.ReadFile(path)
+		if os.IsNotExist(err) && params["upload"] != "" {
+			return nil, fmt.Errorf("uploaded table '%s' doesn't exist", params["upload"])
+		} else if err != nil {
+			return nil, fmt.Errorf("error reading lookup table: %s", err.Error())
+		}
+		data = string(content)
+		if format == "" {
+			format = getTableFormat(path)
+		}
+	}
+	if format == "" {
+		format = "csv"
+	}
+	entries, err := parseLookupTable(data, format)
+	if err != nil {
+		return nil, err
+	}
+
+	switch params["match"] {
+	case "", "exact":
+	case "substring":
+		// replace longer keys first, so "HS3" doesn't replace the beginning of "HS30"
+		sort.SliceStable(entries, func(i, j int) bool { return len(entries[i].key) > len(entries[j].key) })
+	case "regex":
+		for i := range entries {
+			entries[i].regex, err = regexp.Compile(entries[i].key)
+			if err != nil {
+				return nil, fmt.Errorf("invalid regex key '%s': %s", entries[i].key, err.Error())
+			}
+		}
+	default:
+		return nil, fmt.Errorf("invalid match mode '%s', must be 'exact', 'substring' or 'regex'", params["match"])
+	}
+	return entries, nil
+}
+
+// lookup maps a value with the table. Values without a matching key are returned unchanged.
+func lookup(entries []lookupEntry, mode string, value string) string {
+	switch mode {
+	case "substring":
+		// a single pass, so replaced text isn't replaced again
+		var oldnew []string
+		for _, e := range entries {
+			if e.key != "" {
+				oldnew = append(oldnew, e.key, e.value)
+			}
+		}
+		return strings.NewReplacer(oldnew...).Replace(value)
+	case "regex":
+		for _, e := range entries {
+			if e.regex.MatchString(value) {
+				return e.regex.ReplaceAllString(value, e.value)
+			}
+		}
+	default:
+		for _, e := range entries {
+			if e.key == value {
+				return e.value
+			}
+		}
+	}
+	return value
+}
+
+// This module maps property values with a lookup table, e.g. room codes to building addresses or course codes to full names.
+// Parameters:
+// - 'file', 'upload' or 'table', one is mandatory: path of the lookup table, "<profile>/<name>" of a table uploaded through the API,
+// or the table itself. 'file' is not allowed for low-privilege users, 'upload' only with tables of their profiles.
+// - 'format', optional: "csv" (default, "key,value" per line) or "yaml" (mapping of keys to values). Files ending in .yml or .yaml are read as YAML.
+// - 'match', default "exact": "exact" replaces values equal to a key, "substring" replaces all occurrences of the keys,
+// "regex" uses the keys as regexes and replaces the match of the first matching key, the values may contain capture groups like $1
+// - 'property', default "SUMMARY": comma separated list of properties to map, e.g. "LOCATION"
+// - match rules, 'combine', 'after', 'before', 'period', optional: only map matching events, see parseEventMatcher
+// Returns the number of events removed or added (always 0).
+func moduleMap(cal *ics.Calendar, params map[string]string) (int, error) {
+	entries, err := loadLookupTable(params)
+	if err != nil {
+		return 0, err
+	}
+	properties := parsePropertyList(params["property"])
+	matcher, err := parseEventMatcher(params)
+	if err != nil {
+		return 0, err
+	}
+	replace := func(value string) string {
+		return lookup(entries, params["match"], value)
+	}
+
+	for _, component := range cal.Components {
+		switch component.(type) {
+		case *ics.VEvent, *ics.VTodo, *ics.VJournal:
+			item := getItemBase(component)
+			matched, err := matcher.matches(component)
+			if err != nil {
+				log.Warnf("Skipping event: %s", err.Error())
+				continue
+			}
+			if !matched {
+				continue
+			}
+			for _, property := range properties {
+				if rewriteProperty(item, property, replace) {
+					log.Debug("Mapped " + property + " of event with id " + getItemId(item) + "\n")
+				}
+			}
+		}
+	}
+	return 0, nil
+}
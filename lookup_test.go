@@ -0,0 +1,67 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestUploadedLookupTable(t *testing.T) {
+	oldConf := conf
+	defer func() { conf = oldConf }()
+	conf.Server.StoragePath = t.TempDir() + "/"
+	conf.Profiles = map[string]profile{"uni": {}}
+
+	if err := saveTable("uni", "rooms.csv", []byte("HS3,\"Hörsaal 3, Hauptgebäude\"\nB-2.14,Bau B\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveTable("uni", "courses.yml", []byte("'^INF-(\\d+)': 'Informatik $1'\n")); err != nil {
+		t.Fatal(err)
+	}
+	tables, err := listTables("uni")
+	if err != nil || len(tables) != 2 {
+		t.Errorf("listTables = %v, %v", tables, err)
+	}
+
+	entries, err := loadLookupTable(map[string]string{"upload": "uni/rooms.csv"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := lookup(entries, "exact", "HS3"); got != "Hörsaal 3, Hauptgebäude" {
+		t.Errorf("lookup in uploaded CSV table = %q", got)
+	}
+	entries, err = loadLookupTable(map[string]string{"upload": "uni/courses.yml", "match": "regex"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := lookup(entries, "regex", "INF-101"); got != "Informatik 101" {
+		t.Errorf("lookup in uploaded YAML table = %q", got)
+	}
+
+	templates, table, err := parseTemplateParams(map[string]string{"upload": "uni/rooms.csv", "set-LOCATION": "{{lookup .Location}}"}, nil)
+	if err != nil || templates["LOCATION"] == nil || len(table) != 2 {
+		t.Errorf("parseTemplateParams with uploaded table = %v, %v, %v", templates, table, err)
+	}
+
+	for _, test := range []struct{ name, data string }{
+		{"../rooms.csv", "a,b"},
+		{"rooms", "a,b"},
+		{"rooms.txt", "a,b"},
+		{"broken.csv", "a,b,c"},
+		{"broken.yaml", "- a\n- b"},
+	} {
+		if err := saveTable("uni", test.name, []byte(test.data)); err == nil {
+			t.Errorf("saveTable(%q, %q): expected an error", test.name, test.data)
+		}
+	}
+	for _, params := range []map[string]string{
+		{"upload": "uni/missing.csv"},
+		{"upload": "other/rooms.csv"},
+		{"upload": "uni/../uni/rooms.csv"},
+		{"upload": "rooms.csv"},
+		{"upload": "uni/rooms.csv", "table": "a,b"},
+		{},
+	} {
+		if _, err := loadLookupTable(params); err == nil {
+			t.Errorf("loadLookupTable(%v): expected an error", params)
+		}
+	}
+}
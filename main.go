@@ -10,7 +10,7 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
-var version = "2.0.0-beta.4.0"
+var version = "2.0.0-beta.5.0"
 
 var configPath string
 var conf Config
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	ics "github.com/arran4/golang-ical"
+	log "github.com/sirupsen/logrus"
+)
+
+type mergeCandidate struct {
+	event *ics.VEvent
+	start time.Time
+	end   time.Time
+}
+
+// parseMergeParams checks the parameters of the merge-adjacent module and returns the key properties and the tolerance
+func parseMergeParams(params map[string]string) ([]string, time.Duration, error) {
+	keys := parsePropertyList(params["keys"])
+	var tolerance time.Duration
+	if params["tolerance"] != "" {
+		var err error
+		tolerance, err = time.ParseDuration(params["tolerance"])
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid tolerance: %s", err.Error())
+		}
+		if tolerance < 0 {
+			return nil, 0, fmt.Errorf("invalid tolerance: must not be negative")
+		}
+	}
+	return keys, tolerance, nil
+}
+
+// joinDistinct joins the distinct non-empty values in their order
+func joinDistinct(values []string, sep string) string {
+	var distinct []string
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" && !contains(distinct, v) {
+			distinct = append(distinct, v)
+		}
+	}
+	return strings.Join(distinct, sep)
+}
+
+// mergeEvents merges the events into the first one, which gets the start of the first and the latest end.
+// Locations and descriptions are joined, the UID is derived from the UIDs of all events, so it is the same on every refresh.
+func mergeEvents(events []mergeCandidate) {
+	first := events[0].event
+	end := events[0].end
+	var uids, locations, descriptions []string
+	for _, e := range events {
+		if e.end.After(end) {
+			end = e.end
+		}
+		uids = append(uids, e.event.Id())
+		locations = append(locations, ics.FromText(getPropertyValue(&e.event.ComponentBase, ics.ComponentPropertyLocation)))
+		descriptions = append(descriptions, ics.FromText(getPropertyValue(&e.event.ComponentBase, ics.ComponentPropertyDescription)))
+	}
+	setEventTimes(first, events[0].start, end, false)
+	if location := joinDistinct(locations, ", "); location != "" {
+		first.SetProperty(ics.ComponentPropertyLocation, ics.ToText(location))
+	}
+	if description := joinDistinct(descriptions, "\n\n"); description != "" {
+		first.SetProperty(ics.ComponentPropertyDescription, ics.ToText(description))
+	}
+	var escapedUIDs []string
+	for _, uid := range uids {
+		escapedUIDs = append(escapedUIDs, ics.ToText(uid))
+	}
+	first.SetProperty("X-ICAL-RELAY-MERGED", strings.Join(escapedUIDs, ","))
+	sort.Strings(uids)
+	first.SetProperty(ics.ComponentPropertyUniqueId, fmt.Sprintf("merged-%x@ical-relay", sha256.Sum256([]byte(strings.Join(uids, "\n")))))
+}
+
+// This module merges events with equal keys, whose times touch or overlap, e.g. a lab split into three 1-hour events.
+// The merged event starts with the first and ends with the last event. Locations and descriptions are joined.
+// Its UID is derived from the UIDs of the merged events, the original UIDs are kept in X-ICAL-RELAY-MERGED.
+// All-day and recurring events are not merged.
+// Parameters:
+// - 'keys', default "SUMMARY": comma separated list of properties, which have to be equal
+// - 'tolerance', optional: maximum gap between events to merge, e.g. "15m" for breaks. Default is 0, so events have to touch.
+// - match rules, 'combine', 'after', 'before', 'period', optional: only merge matching events, see parseEventMatcher
+// Returns the number of events removed. (always negative)
+func moduleMergeAdjacent(cal *ics.Calendar, params map[string]string) (int, error) {
+	keys, tolerance, err := parseMergeParams(params)
+	if err != nil {
+		return 0, err
+	}
+	loc, err := getParamLocation(params)
+	if err != nil {
+		return 0, err
+	}
+	matcher, err := parseEventMatcher(params)
+	if err != nil {
+		return 0, err
+	}
+
+	// group the events by their keys
+	groups := make(map[string][]mergeCandidate)
+	var groupOrder []string
+	for _, component := range cal.Components {
+		switch component.(type) {
+		case *ics.VEvent:
+			event := component.(*ics.VEvent)
+			if event.GetProperty(ics.ComponentPropertyRrule) != nil || event.GetProperty(ics.ComponentProperty(ics.PropertyRecurrenceId)) != nil {
+				continue
+			}
+			matched, err := matcher.matches(event)
+			if err != nil {
+				log.Warnf("Skipping event: %s", err.Error())
+				continue
+			}
+			if !matched {
+				continue
+			}
+			start, end, allDay, err := getEventTimes(event, loc)
+			if err != nil {
+				log.Warnf("Skipping event: %s", err.Error())
+				continue
+			}
+			if allDay {
+				continue
+			}
+			var key []string
+			for _, k := range keys {
+				key = append(key, strings.Join(getPropertyValues(&event.ComponentBase, k), ","))
+			}
+			groupKey := strings.Join(key, "\x00")
+			if _, ok := groups[groupKey]; !ok {
+				groupOrder = append(groupOrder, groupKey)
+			}
+			groups[groupKey] = append(groups[groupKey], mergeCandidate{event: event, start: start, end: end})
+		}
+	}
+
+	removed := make(map[*ics.VEvent]bool)
+	for _, groupKey := range groupOrder {
+		events := groups[groupKey]
+		sort.SliceStable(events, func(i, j int) bool { return events[i].start.Before(events[j].start) })
+		var cluster []mergeCandidate
+		var clusterEnd time.Time
+		for i, e := range events {
+			if len(cluster) > 0 && !e.start.After(clusterEnd.Add(tolerance)) {
+				cluster = append(cluster, e)
+				if e.end.After(clusterEnd) {
+					clusterEnd = e.end
+				}
+			} else {
+				cluster = []mergeCandidate{e}
+				clusterEnd = e.end
+			}
+			// merge, when the cluster is complete
+			if i == len(events)-1 || events[i+1].start.After(clusterEnd.Add(tolerance)) {
+				if len(cluster) > 1 {
+					log.Debug("Merging " + fmt.Sprint(len(cluster)) + " events into event with id " + cluster[0].event.Id() + "\n")
+					mergeEvents(cluster)
+					for _, c := range cluster[1:] {
+						removed[c.event] = true
+					}
+				}
+			}
+		}
+	}
+
+	var count int
+	for i := len(cal.Components) - 1; i >= 0; i-- { // iterate over events backwards
+		switch cal.Components[i].(type) {
+		case *ics.VEvent:
+			if removed[cal.Components[i].(*ics.VEvent)] {
+				cal.Components = removeFromICS(cal.Components, i)
+				count--
+			}
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	ics "github.com/arran4/golang-ical"
+)
+
+// testEvent returns an event with the UID, summary and UTC times like "20240105T100000"
+func testEvent(uid string, summary string, start string, end string, extra ...string) string {
+	lines := []string{"BEGIN:VEVENT", "UID:" + uid, "DTSTAMP:20240101T000000Z", "DTSTART:" + start + "Z", "DTEND:" + end + "Z", "SUMMARY:" + summary}
+	return strings.Join(append(append(lines, extra...), "END:VEVENT"), "\n")
+}
+
+func TestModuleMergeAdjacent(t *testing.T) {
+	events := strings.Join([]string{
+		// three touching parts of a lab, out of order
+		testEvent("lab-2", "Lab", "20240105T110000", "20240105T120000", "LOCATION:Raum 2"),
+		testEvent("lab-1", "Lab", "20240105T100000", "20240105T110000", "LOCATION:Raum 1", "DESCRIPTION:Teil 1"),
+		testEvent("lab-3", "Lab", "20240105T120000", "20240105T130000", "LOCATION:Raum 2"),
+		// 15 minutes break
+		testEvent("talk-1", "Talk", "20240105T100000", "20240105T110000"),
+		testEvent("talk-2", "Talk", "20240105T111500", "20240105T120000"),
+		// nested in the first part
+		testEvent("meeting-1", "Meeting", "20240105T100000", "20240105T120000"),
+		testEvent("meeting-2", "Meeting", "20240105T103000", "20240105T110000"),
+		// recurring and all-day events aren't merged
+		testEvent("weekly-1", "Weekly", "20240105T100000", "20240105T110000", "RRULE:FREQ=WEEKLY"),
+		testEvent("weekly-2", "Weekly", "20240105T110000", "20240105T120000"),
+		"BEGIN:VEVENT\nUID:day-1\nDTSTAMP:20240101T000000Z\nDTSTART;VALUE=DATE:20240105\nDTEND;VALUE=DATE:20240106\nSUMMARY:Day\nEND:VEVENT",
+		"BEGIN:VEVENT\nUID:day-2\nDTSTAMP:20240101T000000Z\nDTSTART;VALUE=DATE:20240106\nDTEND;VALUE=DATE:20240107\nSUMMARY:Day\nEND:VEVENT",
+	}, "\n")
+
+	tests := []struct {
+		params    map[string]string
+		wantCount int
+		wantTimes map[string]string // summary -> "start-end" of the merged events
+	}{
+		{map[string]string{}, -3, map[string]string{"Lab": "1000-1300", "Talk": "1000-1100,1115-1200", "Meeting": "1000-1200"}},
+		{map[string]string{"tolerance": "15m"}, -4, map[string]string{"Lab": "1000-1300", "Talk": "1000-1200", "Meeting": "1000-1200"}},
+		{map[string]string{"tolerance": "14m"}, -3, map[string]string{"Talk": "1000-1100,1115-1200"}},
+		// with the location as key, only the parts in Raum 2 are merged, the merged event keeps its position
+		{map[string]string{"keys": "SUMMARY,LOCATION"}, -2, map[string]string{"Lab": "1100-1300,1000-1100"}},
+		{map[string]string{"regex-SUMMARY": "^Lab$"}, -2, map[string]string{"Lab": "1000-1300", "Talk": "1000-1100,1115-1200"}},
+	}
+	for _, test := range tests {
+		cal := testCalendar(t, events)
+		test.params["timezone"] = "UTC"
+		count, err := moduleMergeAdjacent(cal, test.params)
+		if err != nil {
+			t.Errorf("moduleMergeAdjacent(%v): unexpected error: %v", test.params, err)
+			continue
+		}
+		if count != test.wantCount {
+			t.Errorf("moduleMergeAdjacent(%v) = %d, want %d", test.params, count, test.wantCount)
+		}
+		times := make(map[string][]string)
+		for _, event := range cal.Events() {
+			start, end, _, err := getEventTimes(event, time.UTC)
+			if err != nil {
+				t.Fatal(err)
+			}
+			summary := getPropertyValue(&event.ComponentBase, ics.ComponentPropertySummary)
+			times[summary] = append(times[summary], start.Format("1504")+"-"+end.Format("1504"))
+		}
+		for summary, want := range test.wantTimes {
+			if got := strings.Join(times[summary], ","); got != want {
+				t.Errorf("moduleMergeAdjacent(%v): %s at %s, want %s", test.params, summary, got, want)
+			}
+		}
+		if len(times["Weekly"]) != 2 || len(times["Day"]) != 2 {
+			t.Errorf("moduleMergeAdjacent(%v) merged recurring or all-day events", test.params)
+		}
+	}
+
+	// the merged event gets the joined locations and descriptions and a stable UID
+	lab := []string{
+		testEvent("lab-1", "Lab", "20240105T100000", "20240105T110000", "LOCATION:Raum 1"),
+		testEvent("lab-2", "Lab", "20240105T110000", "20240105T120000", "LOCATION:Raum 2"),
+		testEvent("lab-3", "Lab", "20240105T120000", "20240105T130000", "LOCATION:Raum 3"),
+	}
+	var uids []string
+	for _, order := range [][]string{{lab[0], lab[1], lab[2]}, {lab[2], lab[0], lab[1]}} {
+		cal := testCalendar(t, strings.Join(order, "\n"))
+		if _, err := moduleMergeAdjacent(cal, map[string]string{"timezone": "UTC"}); err != nil {
+			t.Fatal(err)
+		}
+		merged := &cal.Events()[0].ComponentBase
+		if location := ics.FromText(getPropertyValue(merged, ics.ComponentPropertyLocation)); location != "Raum 1, Raum 2, Raum 3" {
+			t.Errorf("merged location = %q", location)
+		}
+		uids = append(uids, getItemId(merged))
+	}
+	if uids[0] != uids[1] || !strings.HasPrefix(uids[0], "merged-") {
+		t.Errorf("UIDs of merged events = %v, want the same merged- UID", uids)
+	}
+
+	if _, err := moduleMergeAdjacent(testCalendar(t, events), map[string]string{"tolerance": "-5m"}); err == nil {
+		t.Error("expected an error for a negative tolerance")
+	}
+}
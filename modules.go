@@ -25,6 +25,27 @@ var modules = map[string]func(*ics.Calendar, map[string]string) (int, error){
 	"edit-bysummary-regex":   moduleEditSummaryRegex,
 	"save-to-file":           moduleSaveToFile,
 	"add-reminder":           moduleAddAllReminder,
+	"period":                 modulePeriod,
+	"holidays":               moduleHolidays,
+	"filter":                 moduleFilter,
+	"expression":             moduleExpression,
+	"rewrite":                moduleRewrite,
+	"map":                    moduleMap,
+	"categorize":             moduleCategorize,
+	"anonymize":              moduleAnonymize,
+	"sanitize":               moduleSanitize,
+	"template":               moduleTemplate,
+	"merge-adjacent":         moduleMergeAdjacent,
+	"conflicts":              moduleConflicts,
+	"travel-time":            moduleTravelTime,
+	"alarm":                  moduleAlarm,
+	"normalize-timezone":     moduleNormalizeTimezone,
+	"repair":                 moduleRepair,
+}
+
+func init() {
+	// add-profile builds other profiles with the modules above, so it can't be part of the initialization of the map
+	modules["add-profile"] = moduleAddProfile
 }
 
 // These modules are allowed to be edited by the module admin. This is a security measure to prevent SSRF and LFI attacks.
@@ -35,6 +56,187 @@ var lowPrivModules = []string{
 	"delete-duplicates",
 	"edit-byid",
 	"edit-bysummary-regex",
+	"period",
+	"holidays",
+	"filter",
+	"expression",
+	"rewrite",
+	"map",
+	"categorize",
+	"anonymize",
+	"sanitize",
+	"template",
+	"merge-adjacent",
+	"conflicts",
+	"travel-time",
+	"alarm",
+	"normalize-timezone",
+	"repair",
+	"add-profile",
+}
+
+// These parameters of low-privilege modules are only allowed for the super user, e.g. because they read local files.
+var lowPrivDeniedParams = map[string][]string{
+	"map":         {"file"},
+	"template":    {"file"},
+	"travel-time": {"file"},
+}
+
+// These functions check the parameters of a module, before it is saved through the API.
+// Modules without a validator are only checked when they are run.
+var moduleValidators = map[string]func(map[string]string) error{
+	"expression": validateExpressionModule,
+	"filter": func(params map[string]string) error {
+		if err := checkFilterMode(params); err != nil {
+			return err
+		}
+		_, err := parseEventMatcher(params)
+		return err
+	},
+	"rewrite": func(params map[string]string) error {
+		if params["regex"] == "" {
+			return fmt.Errorf("missing mandatory Parameter 'regex'")
+		}
+		if _, err := regexp.Compile(params["regex"]); err != nil {
+			return fmt.Errorf("invalid regex: %s", err.Error())
+		}
+		_, err := parseEventMatcher(params)
+		return err
+	},
+	"map": func(params map[string]string) error {
+		if params["file"] == "" {
+			// files are only read when the module runs, since they may change. Uploaded tables have to exist.
+			if _, err := loadLookupTable(params); err != nil {
+				return err
+			}
+		}
+		_, err := parseEventMatcher(params)
+		return err
+	},
+	"categorize": func(params map[string]string) error {
+		if _, err := parseCategorizeParams(params); err != nil {
+			return err
+		}
+		_, err := parseEventMatcher(params)
+		return err
+	},
+	"anonymize": func(params map[string]string) error {
+		if _, err := parseAnonymizeParams(params); err != nil {
+			return err
+		}
+		_, err := parseEventMatcher(params)
+		return err
+	},
+	"sanitize": func(params map[string]string) error {
+		if _, err := parseSanitizeParams(params); err != nil {
+			return err
+		}
+		_, err := parseEventMatcher(params)
+		return err
+	},
+	"template": func(params map[string]string) error {
+		loc, err := getParamLocation(params)
+		if err != nil {
+			return err
+		}
+		// files are only read when the module runs, since they may change
+		withoutFile := make(map[string]string)
+		for k, v := range params {
+			if k != "file" {
+				withoutFile[k] = v
+			}
+		}
+		if _, _, err := parseTemplateParams(withoutFile, loc); err != nil {
+			return err
+		}
+		_, err = parseEventMatcher(params)
+		return err
+	},
+	"delete-duplicates": func(params map[string]string) error {
+		_, _, err := parseDuplicateParams(params)
+		return err
+	},
+	"conflicts": func(params map[string]string) error {
+		if params["include-allday"] != "" && params["include-allday"] != "true" && params["include-allday"] != "false" {
+			return fmt.Errorf("invalid value for 'include-allday': %s", params["include-allday"])
+		}
+		_, err := parseEventMatcher(params)
+		return err
+	},
+	"travel-time": func(params map[string]string) error {
+		// files are only read when the module runs, since they may change
+		if _, _, err := parseTravelParams(params, false); err != nil {
+			return err
+		}
+		_, err := parseEventMatcher(params)
+		return err
+	},
+	"merge-adjacent": func(params map[string]string) error {
+		if _, _, err := parseMergeParams(params); err != nil {
+			return err
+		}
+		_, err := parseEventMatcher(params)
+		return err
+	},
+	"alarm": func(params map[string]string) error {
+		loc, err := getParamLocation(params)
+		if err != nil {
+			return err
+		}
+		if _, err := parseAlarmParams(params, loc); err != nil {
+			return err
+		}
+		_, err = parseEventMatcher(params)
+		return err
+	},
+	"normalize-timezone": func(params map[string]string) error {
+		if params["target"] == "" {
+			return fmt.Errorf("missing mandatory Parameter 'target'")
+		}
+		if _, err := time.LoadLocation(params["target"]); err != nil {
+			return fmt.Errorf("invalid target timezone '%s': %s", params["target"], err.Error())
+		}
+		_, err := getParamLocation(params)
+		return err
+	},
+	"repair": func(params map[string]string) error {
+		if _, err := parseRepairParams(params); err != nil {
+			return err
+		}
+		_, err := getParamLocation(params)
+		return err
+	},
+	"add-reminder": func(params map[string]string) error {
+		_, err := parseLegacyReminder(params["time"])
+		return err
+	},
+	"delete-bysummary-regex": func(params map[string]string) error {
+		if params["regex"] == "" {
+			return fmt.Errorf("missing mandatory Parameter 'regex'")
+		}
+		if _, err := regexp.Compile(params["regex"]); err != nil {
+			return fmt.Errorf("invalid regex: %s", err.Error())
+		}
+		return checkDeleteMode(params)
+	},
+	"delete-byid": func(params map[string]string) error {
+		if params["id"] == "" {
+			return fmt.Errorf("missing mandatory Parameter 'id'")
+		}
+		return checkDeleteMode(params)
+	},
+	"delete-timeframe": checkDeleteMode,
+	"period":           checkDeleteMode,
+	"holidays":         checkDeleteMode,
+	"add-profile": func(params map[string]string) error {
+		if params["profile"] == "" {
+			return fmt.Errorf("missing mandatory Parameter 'profile'")
+		}
+		if !conf.profileExists(params["profile"]) {
+			return fmt.Errorf("profile '%s' doesn't exist", params["profile"])
+		}
+		return nil
+	},
 }
 
 // This wrappter gets a function from the above modules map and calls it with the parameters and the passed calendar.
@@ -47,8 +249,10 @@ func callModule(module func(*ics.Calendar, map[string]string) (int, error), para
 // This modules delete all events whose summary match the regex and are in the time range from the calendar.
 // Parameters:
 //   - 'regex', mandatory: regular expression to remove.
-//   - 'from' & 'until', optional parameters: If timeframe is not given, all events matching the regex are removed.
-//     Currenty if only either "from" or "until" is set, the timeframe will be ignored. TODO
+//   - 'from' & 'until', optional parameters: time expressions limiting the timeframe. If timeframe is not given, all events matching the regex are removed.
+//   - 'period', optional: name of a period from the config to use as timeframe. 'from' and 'until' override its start and end.
+//   - 'mode', default "delete": "delete" removes the events, "cancel" keeps them with STATUS:CANCELLED and an increased SEQUENCE
+//   - 'prefix', optional: text prepended to the summary of cancelled events
 //
 // Returns the number of events removed. This number should always be negative.
 func moduleDeleteSummaryRegex(cal *ics.Calendar, params map[string]string) (int, error) {
@@ -56,42 +260,47 @@ func moduleDeleteSummaryRegex(cal *ics.Calendar, params map[string]string) (int,
 	if params["regex"] == "" {
 		return 0, fmt.Errorf("missing mandatory Parameter 'regex'")
 	}
-	regex, _ := regexp.Compile(params["regex"])
-	if params["from"] != "" && params["until"] != "" {
-		from, _ := time.Parse(time.RFC3339, params["from"])
-		until, _ := time.Parse(time.RFC3339, params["until"])
-		count = removeByRegexSummaryAndTime(cal, *regex, from, until)
-	} else {
-		count = removeByRegexSummary(cal, *regex)
+	if err := checkDeleteMode(params); err != nil {
+		return 0, err
+	}
+	regex, err := regexp.Compile(params["regex"])
+	if err != nil {
+		return 0, fmt.Errorf("invalid regex: %s", err.Error())
+	}
+	loc, err := getParamLocation(params)
+	if err != nil {
+		return 0, err
+	}
+	from, until, err := parseTimeframe(params, "from", "until", loc)
+	if err != nil {
+		return 0, err
 	}
+	count = removeByRegexSummaryAndTime(cal, *regex, from, until, loc, params)
 	if count > 0 {
 		return count, fmt.Errorf("this number should not be positive")
 	}
 	return count, nil
 }
 
-// This function is a wrapper for removeByRegexSummaryAndTime, where the time is any time
-func removeByRegexSummary(cal *ics.Calendar, regex regexp.Regexp) int {
-	return removeByRegexSummaryAndTime(cal, regex, time.Time{}, time.Unix(1<<63-1-int64((1969*365+1969/4-1969/100+1969/400)*24*60*60), 999999999))
-	// this is the maximum time that can be represented in the time.Time struct
-}
-
 // This function is used to remove the events that are in the time range and match the regex string.
+// Floating and all-day events are read in loc. The events are cancelled instead, if the 'mode' parameter is "cancel".
 // It returns the number of events removed. (always negative)
-func removeByRegexSummaryAndTime(cal *ics.Calendar, regex regexp.Regexp, start time.Time, end time.Time) int {
+func removeByRegexSummaryAndTime(cal *ics.Calendar, regex regexp.Regexp, start time.Time, end time.Time, loc *time.Location, params map[string]string) int {
 	var count int
 	for i := len(cal.Components) - 1; i >= 0; i-- { // iterate over events
 		switch cal.Components[i].(type) {
-		case *ics.VEvent:
-			event := cal.Components[i].(*ics.VEvent)
-			date, _ := event.GetStartAt()
-			if date.After(start) && end.After(date) {
+		case *ics.VEvent, *ics.VTodo, *ics.VJournal:
+			inTimeframe, err := eventInTimeframe(cal.Components[i], start, end, loc)
+			if err != nil {
+				log.Warnf("Skipping event: %s", err.Error())
+				continue
+			}
+			if inTimeframe {
 				// event is in time range
-				if regex.MatchString(event.GetProperty(ics.ComponentPropertySummary).Value) {
+				summary := getPropertyValue(getItemBase(cal.Components[i]), ics.ComponentPropertySummary)
+				if regex.MatchString(summary) {
 					// event matches regex
-					cal.Components = removeFromICS(cal.Components, i)
-					log.Debug("Excluding event '" + event.GetProperty(ics.ComponentPropertySummary).Value + "' with id " + event.Id() + "\n")
-					count--
+					count += deleteOrCancelEvent(cal, i, params)
 				}
 			}
 		default:
@@ -104,34 +313,38 @@ func removeByRegexSummaryAndTime(cal *ics.Calendar, regex regexp.Regexp, start t
 
 // This module deletes an Event with the given id.
 // Parameters: "id" mandatory
+// - 'mode', default "delete": "delete" removes the event, "cancel" keeps it with STATUS:CANCELLED and an increased SEQUENCE
+// - 'prefix', optional: text prepended to the summary of cancelled events
 // Returns the number of events removed.
 func moduleDeleteId(cal *ics.Calendar, params map[string]string) (int, error) {
 	var count int
 	if params["id"] == "" {
 		return 0, fmt.Errorf("missing mandatory Parameter 'id'")
 	}
-	for i, component := range cal.Components { // iterate over events
-		switch component.(type) {
-		case *ics.VEvent:
-			event := component.(*ics.VEvent)
-			if event.Id() == params["id"] {
-				cal.Components = removeFromICS(cal.Components, i)
-				count--
-				log.Debug("Excluding event with id " + params["id"] + "\n")
-				break
+	if err := checkDeleteMode(params); err != nil {
+		return 0, err
+	}
+	for i := len(cal.Components) - 1; i >= 0; i-- { // iterate over events backwards
+		switch cal.Components[i].(type) {
+		case *ics.VEvent, *ics.VTodo, *ics.VJournal:
+			if getItemId(getItemBase(cal.Components[i])) == params["id"] {
+				// recurring events may have several components with the same id
+				count += deleteOrCancelEvent(cal, i, params)
 			}
 		}
 	}
 	return count, nil
 }
 
-// This function adds all events from cal2 to cal1.
+// This function adds all events, todos and journal entries from cal2 to cal1.
 // All other properties, such as TZ are retained from cal1.
 func addEvents(cal1 *ics.Calendar, cal2 *ics.Calendar) int {
 	var count int
-	for _, event := range cal2.Events() {
-		cal1.AddVEvent(event)
-		count++
+	for _, component := range cal2.Components {
+		if getItemBase(component) != nil {
+			cal1.Components = append(cal1.Components, component)
+			count++
+		}
 	}
 	return count
 }
@@ -176,7 +389,7 @@ func addEventsURL(cal *ics.Calendar, url string, headers map[string]string) (int
 		return 0, nil // we are not returning an error here, to just ignore URLs that are unavailible. TODO: make this configurable
 	}
 	// parse aditional calendar
-	addcal, err := ics.ParseCalendar(response.Body)
+	addcal, err := parseCalendar(response.Body)
 	if err != nil {
 		log.Errorln(err)
 	}
@@ -221,8 +434,15 @@ func addEventsFile(cal *ics.Calendar, filename string) (int, error) {
 	if _, err := os.Stat(filename); err != nil {
 		return 0, fmt.Errorf("file %s not found", filename)
 	}
-	addicsfile, _ := os.Open(filename)
-	addics, _ := ics.ParseCalendar(addicsfile)
+	addicsfile, err := os.Open(filename)
+	if err != nil {
+		return 0, err
+	}
+	defer addicsfile.Close()
+	addics, err := parseCalendar(addicsfile)
+	if err != nil {
+		return 0, fmt.Errorf("error parsing file %s: %s", filename, err.Error())
+	}
 	return addEvents(cal, addics), nil
 }
 
@@ -238,55 +458,68 @@ func addMultiFile(cal *ics.Calendar, filenames []string) (int, error) {
 	return count, nil
 }
 
+// This module adds all events of another profile of the relay. The profile is built in-process with all its modules,
+// instead of requesting it over HTTP.
+// Parameters:
+// - 'profile', mandatory: name of the profile
+// Returns the number of events added.
+func moduleAddProfile(cal *ics.Calendar, params map[string]string) (int, error) {
+	return addProfileEvents(cal, params, nil)
+}
+
+// addProfileEvents adds the events of the profile in params["profile"] to cal.
+// chain contains the profiles currently being built, see buildProfileCalendar.
+func addProfileEvents(cal *ics.Calendar, params map[string]string, chain []string) (int, error) {
+	if params["profile"] == "" {
+		return 0, fmt.Errorf("missing mandatory Parameter 'profile'")
+	}
+	profile, ok := conf.Profiles[params["profile"]]
+	if !ok {
+		return 0, fmt.Errorf("profile '%s' doesn't exist", params["profile"])
+	}
+	included, err := buildProfileCalendar(profile, params["profile"], chain)
+	if err != nil {
+		return 0, err
+	}
+	return addEvents(cal, included), nil
+}
+
 // Removes all Events in a passed Timeframe.
 // Sets UNTIL parameter to the end of the timeframe for RRULE events.
-// Parameters: either "after" or "before" mandatory
-// Format is RFC3339: "2006-01-02T15:04:05Z"
-// or "now" for current time
+// Parameters: either "after", "before" or "period" (name of a period from the config) mandatory
+// Format is a time expression, see parseTimeExpression: e.g. "2006-01-02T15:04:05Z", "now" or "now-30d"
+// 'mode', default "delete": "delete" removes the events, "cancel" keeps them with STATUS:CANCELLED and an increased SEQUENCE.
+// RRULEs are shortened in both modes. 'prefix', optional: text prepended to the summary of cancelled events
 // Returns the number of events removed. (always negative)
 func moduleDeleteTimeframe(cal *ics.Calendar, params map[string]string) (int, error) {
 	var count int
-	var after time.Time
-	var before time.Time
-	var err error
-	if params["after"] == "" && params["before"] == "" {
-		return 0, fmt.Errorf("missing both Parameters 'start' or 'end'. One has to be present")
-	}
-	if params["after"] == "" {
-		log.Debug("No after time given. Using time 0.\n")
-		after = time.Time{}
-	} else if params["after"] == "now" {
-		after = time.Now()
-	} else {
-		after, err = time.Parse(time.RFC3339, params["after"])
-		if err != nil {
-			return 0, fmt.Errorf("invalid start time: %s", err.Error())
-		}
+	if params["after"] == "" && params["before"] == "" && params["period"] == "" {
+		return 0, fmt.Errorf("missing both Parameters 'start' or 'end'. One has to be present, or 'period'")
 	}
-	if params["before"] == "" {
-		log.Debug("No end time given. Using max time\n")
-		before = time.Unix(1<<63-1-int64((1969*365+1969/4-1969/100+1969/400)*24*60*60), 999999999)
-	} else if params["before"] == "now" {
-		before = time.Now()
-	} else {
-		before, err = time.Parse(time.RFC3339, params["before"])
-		if err != nil {
-			return 0, fmt.Errorf("invalid end time: %s", err.Error())
-		}
+	if err := checkDeleteMode(params); err != nil {
+		return 0, err
+	}
+	loc, err := getParamLocation(params)
+	if err != nil {
+		return 0, err
+	}
+	after, before, err := parseTimeframe(params, "after", "before", loc)
+	if err != nil {
+		return 0, err
 	}
 
 	log.Debugf("Deleting events between %s and %s\n", after.Format(time.RFC3339), before.Format(time.RFC3339))
 	// remove events
 	for i := len(cal.Components) - 1; i >= 0; i-- { // iterate over events
 		switch cal.Components[i].(type) {
-		case *ics.VEvent:
-			event := cal.Components[i].(*ics.VEvent)
-			if event.GetProperty(ics.ComponentPropertyRrule) != nil {
+		case *ics.VEvent, *ics.VTodo, *ics.VJournal:
+			item := getItemBase(cal.Components[i])
+			if item.GetProperty(ics.ComponentPropertyRrule) != nil {
 				// event has RRULE
 				// TODO handle RRULEs in the past?
-				log.Debug("Event with RRULE: " + event.Id())
+				log.Debug("Event with RRULE: " + getItemId(item))
 				// read RRULE, split into different rule parts
-				props := strings.Split(event.GetProperty(ics.ComponentPropertyRrule).Value, ";")
+				props := strings.Split(item.GetProperty(ics.ComponentPropertyRrule).Value, ";")
 				// cast into map for easy queries
 				m := make(map[string]string)
 				for _, e := range props {
@@ -303,15 +536,15 @@ func moduleDeleteTimeframe(cal *ics.Calendar, params map[string]string) (int, er
 					// only checking after to not break RRULEs with UNTIL in the past
 					if until.After(after) {
 						// RRULE UNTIL is not in timeframe, shortening UNTIL
-						log.Debug("Shortening UNTIL in RRULE of event with id " + event.Id() + "\n")
+						log.Debug("Shortening UNTIL in RRULE of event with id " + getItemId(item) + "\n")
 						m["UNTIL"] = after.Format("20060102T150405Z")
 					}
 				} else if _, ok := m["COUNT"]; ok {
 					// TODO implement calculating COUNT
-					log.Debug("COUNT in RRULE of event with id " + event.Id() + " not implemented\n")
+					log.Debug("COUNT in RRULE of event with id " + getItemId(item) + " not implemented\n")
 				} else {
 					// no UNTIL or COUNT, adding UNTIL
-					log.Debug("Adding UNTIL in RRULE of event with id " + event.Id() + "\n")
+					log.Debug("Adding UNTIL in RRULE of event with id " + getItemId(item) + "\n")
 					m["UNTIL"] = after.Format("20060102T150405Z")
 				}
 				// reassemble RRULE
@@ -320,20 +553,16 @@ func moduleDeleteTimeframe(cal *ics.Calendar, params map[string]string) (int, er
 					rrulestring += k + "=" + v + ";"
 				}
 				// delete old RRULE. TODO upstream function to delete property
-				for i, p := range event.Properties {
-					if ics.ComponentProperty(p.IANAToken) == ics.ComponentPropertyRrule {
-						removeProperty(event.Properties, i)
-					}
-				}
-				event.AddRrule(rrulestring)
-				// adding edited event back to calendar
-				cal.Components[i] = event
+				removePropertyByName(item, ics.ComponentPropertyRrule)
+				item.AddProperty(ics.ComponentPropertyRrule, rrulestring)
+			}
+			inTimeframe, err := eventInTimeframe(cal.Components[i], after, before, loc)
+			if err != nil {
+				log.Warnf("Skipping event: %s", err.Error())
+				continue
 			}
-			date, _ := event.GetStartAt()
-			if date.After(after) && before.After(date) {
-				cal.Components = removeFromICS(cal.Components, i)
-				count--
-				log.Debug("Excluding event with id " + event.Id() + "\n")
+			if inTimeframe {
+				count += deleteOrCancelEvent(cal, i, params)
 			}
 		}
 	}
@@ -341,41 +570,143 @@ func moduleDeleteTimeframe(cal *ics.Calendar, params map[string]string) (int, er
 	return count, nil
 }
 
-// This Module deletes duplicate Events.
-// No Parameters
+// This Module deletes duplicate Events, todos and journal entries.
+// Duplicates are items of the same type with equal keys, whose start and end times differ by at most the tolerance.
+// Todos and journal entries without dates are duplicates, if their keys are equal.
+// Parameters:
+// - 'keys', default "SUMMARY": comma separated list of properties, which have to be equal
+// - 'tolerance', optional: maximum difference of start and end times, e.g. "5m". Default is 0, so the times have to be equal.
+// - 'strategy', default "keep-last": "keep-last" keeps the event that is latest in the file, "keep-first" the first one,
+// "merge" keeps the latest and adds the descriptions, locations and categories of the duplicates to it
+// - 'report', default false: if "true", the UIDs of the kept events and their duplicates are logged at info level
+// - 'mode', default "delete": "delete" removes the duplicates, "cancel" keeps them with STATUS:CANCELLED and an increased SEQUENCE
+// - 'prefix', optional: text prepended to the summary of cancelled duplicates
 // Returns the number of events removed. (always negative)
-// Duplicates are defined by the same Summary and the same start and end time. Only the event that is latest in the file will be kept.
-// TODO smarter: if the description or other components differ, it should combine them
 func moduleDeleteDuplicates(cal *ics.Calendar, params map[string]string) (int, error) {
 	var count int
-	var uniques []string
-	for i := len(cal.Components) - 1; i >= 0; i-- { // iterate over events backwards
-		switch cal.Components[i].(type) {
-		case *ics.VEvent:
-			event := cal.Components[i].(*ics.VEvent)
-			start, _ := event.GetStartAt()
-			end, _ := event.GetEndAt()
-			identifier := start.String() + end.String() + event.GetProperty(ics.ComponentPropertySummary).Value
-			if stringInSlice(identifier, uniques) {
-				cal.Components = removeFromICS(cal.Components, i)
-				count--
-				log.Debug("Excluding event with id " + event.Id() + "\n")
-			} else {
-				uniques = append(uniques, identifier)
+	keys, tolerance, err := parseDuplicateParams(params)
+	if err != nil {
+		return 0, err
+	}
+	loc, err := getParamLocation(params)
+	if err != nil {
+		return 0, err
+	}
+
+	// the kept items, grouped by their type and keys, and their duplicates
+	type duplicateCandidate struct {
+		item       *ics.ComponentBase
+		start, end time.Time
+	}
+	uniques := make(map[string][]duplicateCandidate)
+	duplicates := make(map[*ics.ComponentBase][]*ics.ComponentBase)
+	isRemoved := make(map[*ics.ComponentBase]bool)
+	var originals []*ics.ComponentBase
+	for n := range cal.Components {
+		i := len(cal.Components) - 1 - n // iterate over events backwards, so the latest event is kept
+		if params["strategy"] == "keep-first" {
+			i = n
+		}
+		item := getItemBase(cal.Components[i])
+		if item == nil {
+			continue
+		}
+		// todos and journal entries without dates are duplicates, if their keys are equal
+		start, end, allDay, err := getItemTimes(cal.Components[i], loc)
+		if err != nil && err != errUndated {
+			log.Warnf("Skipping event: %s", err.Error())
+			continue
+		}
+		identifier := getItemType(cal.Components[i]) + "\x00" + fmt.Sprint(allDay, err == errUndated)
+		for _, k := range keys {
+			identifier += "\x00" + strings.Join(getPropertyValues(item, k), ",")
+		}
+		var original *ics.ComponentBase
+		for _, u := range uniques[identifier] {
+			if absDuration(u.start.Sub(start)) <= tolerance && absDuration(u.end.Sub(end)) <= tolerance {
+				original = u.item
+				break
+			}
+		}
+		if original == nil {
+			uniques[identifier] = append(uniques[identifier], duplicateCandidate{item: item, start: start, end: end})
+			continue
+		}
+		if len(duplicates[original]) == 0 {
+			originals = append(originals, original)
+		}
+		duplicates[original] = append(duplicates[original], item)
+		isRemoved[item] = true
+		log.Debug("Excluding " + getItemType(cal.Components[i]) + " with id " + getItemId(item) + " as duplicate of " + getItemId(original) + "\n")
+	}
+
+	for _, original := range originals {
+		if params["strategy"] == "merge" {
+			mergeDuplicates(original, duplicates[original])
+		}
+		if params["report"] == "true" {
+			// the report is only logged, the UIDs of the source must not be published in the feed
+			var uids []string
+			for _, d := range duplicates[original] {
+				uids = append(uids, getItemId(d))
 			}
+			log.Infof("Duplicates of %s: %s", getItemId(original), strings.Join(uids, ", "))
+		}
+	}
+
+	for i := len(cal.Components) - 1; i >= 0; i-- { // iterate over events backwards
+		if item := getItemBase(cal.Components[i]); item != nil && isRemoved[item] {
+			count += deleteOrCancelEvent(cal, i, params)
 		}
 	}
 	return count, nil
 }
 
+// parseDuplicateParams checks the parameters of the delete-duplicates module and returns the key properties and the tolerance
+func parseDuplicateParams(params map[string]string) ([]string, time.Duration, error) {
+	switch params["strategy"] {
+	case "", "keep-last", "keep-first", "merge":
+	default:
+		return nil, 0, fmt.Errorf("invalid strategy '%s', must be 'keep-last', 'keep-first' or 'merge'", params["strategy"])
+	}
+	if params["report"] != "" && params["report"] != "true" && params["report"] != "false" {
+		return nil, 0, fmt.Errorf("invalid value for 'report': %s", params["report"])
+	}
+	if err := checkDeleteMode(params); err != nil {
+		return nil, 0, err
+	}
+	// same parameters as merge-adjacent
+	return parseMergeParams(params)
+}
+
+// mergeDuplicates adds the descriptions, locations and categories of the duplicates to the original item
+func mergeDuplicates(original *ics.ComponentBase, duplicates []*ics.ComponentBase) {
+	locations := []string{ics.FromText(getPropertyValue(original, ics.ComponentPropertyLocation))}
+	descriptions := []string{ics.FromText(getPropertyValue(original, ics.ComponentPropertyDescription))}
+	for _, d := range duplicates {
+		locations = append(locations, ics.FromText(getPropertyValue(d, ics.ComponentPropertyLocation)))
+		descriptions = append(descriptions, ics.FromText(getPropertyValue(d, ics.ComponentPropertyDescription)))
+		for _, c := range getCategories(d) {
+			addCategory(original, c)
+		}
+	}
+	if location := joinDistinct(locations, ", "); location != "" {
+		original.SetProperty(ics.ComponentPropertyLocation, ics.ToText(location))
+	}
+	if description := joinDistinct(descriptions, "\n\n"); description != "" {
+		original.SetProperty(ics.ComponentPropertyDescription, ics.ToText(description))
+	}
+}
+
 // Edits an Event with the passed id.
 // Parameters:
 // - 'id', mandatory: the id of the event to edit
 // - 'overwrite', default true: overwrite existing event properties with the new ones. If false, it will be appended to the existing property. Does not apply to 'new-start' and 'new-end'
 // - 'new-summary', optional: the new summary
 // - 'new-description', optional: the new description
-// - 'new-start', optional: the new start time in RFC3339 format "2006-01-02T15:04:05Z"
-// - 'new-end', optional: the new end time in RFC3339 format "2006-01-02T15:04:05Z"
+// - 'new-start', optional: the new start time as time expression, e.g. "2006-01-02T15:04:05Z", or a date "2006-01-02" for all-day events
+// - 'new-end', optional: the new end time as time expression, e.g. "2006-01-02T15:04:05Z", or a date "2006-01-02" for all-day events (exclusive)
+// - 'new-allday', optional: "true" turns the event into an all-day event on the same days, "false" into a timed event
 // - 'new-location', optional: the new location
 // The return value is the number of events removed or added (should always be 0)
 func moduleEditId(cal *ics.Calendar, params map[string]string) (int, error) {
@@ -385,81 +716,71 @@ func moduleEditId(cal *ics.Calendar, params map[string]string) (int, error) {
 	if params["overwrite"] == "" {
 		params["overwrite"] = "true"
 	}
+	loc, err := getParamLocation(params)
+	if err != nil {
+		return 0, err
+	}
 	for i := len(cal.Components) - 1; i >= 0; i-- { // iterate over events backwards
 		switch cal.Components[i].(type) {
-		case *ics.VEvent:
-			event := cal.Components[i].(*ics.VEvent)
-			if event.Id() == params["id"] {
-				log.Debug("Changing event with id " + event.Id())
+		case *ics.VEvent, *ics.VTodo, *ics.VJournal:
+			item := getItemBase(cal.Components[i])
+			if getItemId(item) == params["id"] {
+				log.Debug("Changing event with id " + getItemId(item))
 				if params["new-summary"] != "" {
-					if event.GetProperty(ics.ComponentPropertySummary) == nil {
+					if item.GetProperty(ics.ComponentPropertySummary) == nil {
 						params["overwrite"] = "true"
 						// if the summary is not set, we need to create it
 					}
 					switch params["overwrite"] {
 					case "false":
-						event.SetProperty(ics.ComponentPropertySummary, event.GetProperty(ics.ComponentPropertySummary).Value+"; "+params["new-summary"])
+						item.SetProperty(ics.ComponentPropertySummary, item.GetProperty(ics.ComponentPropertySummary).Value+"; "+params["new-summary"])
 					case "fillempty":
-						if event.GetProperty(ics.ComponentPropertySummary).Value == "" {
-							event.SetProperty(ics.ComponentPropertySummary, params["new-summary"])
+						if item.GetProperty(ics.ComponentPropertySummary).Value == "" {
+							item.SetProperty(ics.ComponentPropertySummary, params["new-summary"])
 						}
 					case "true":
-						event.SetProperty(ics.ComponentPropertySummary, params["new-summary"])
+						item.SetProperty(ics.ComponentPropertySummary, params["new-summary"])
 					}
-					log.Debug("Changed summary to " + event.GetProperty(ics.ComponentPropertySummary).Value)
+					log.Debug("Changed summary to " + item.GetProperty(ics.ComponentPropertySummary).Value)
 				}
 				if params["new-description"] != "" {
-					if event.GetProperty(ics.ComponentPropertyDescription) == nil {
+					if item.GetProperty(ics.ComponentPropertyDescription) == nil {
 						params["overwrite"] = "true"
 						// if the description is not set, we need to create it
 					}
 					switch params["overwrite"] {
 					case "false":
-						event.SetProperty(ics.ComponentPropertyDescription, event.GetProperty(ics.ComponentPropertyDescription).Value+"; "+params["new-description"])
+						item.SetProperty(ics.ComponentPropertyDescription, item.GetProperty(ics.ComponentPropertyDescription).Value+"; "+params["new-description"])
 					case "fillempty":
-						if event.GetProperty(ics.ComponentPropertyDescription).Value == "" {
-							event.SetProperty(ics.ComponentPropertyDescription, params["new-description"])
+						if item.GetProperty(ics.ComponentPropertyDescription).Value == "" {
+							item.SetProperty(ics.ComponentPropertyDescription, params["new-description"])
 						}
 					case "true":
-						event.SetProperty(ics.ComponentPropertyDescription, params["new-description"])
+						item.SetProperty(ics.ComponentPropertyDescription, params["new-description"])
 					}
-					log.Debug("Changed description to " + event.GetProperty(ics.ComponentPropertyDescription).Value)
+					log.Debug("Changed description to " + item.GetProperty(ics.ComponentPropertyDescription).Value)
 				}
 				if params["new-location"] != "" {
-					if event.GetProperty(ics.ComponentPropertyLocation) == nil {
+					if item.GetProperty(ics.ComponentPropertyLocation) == nil {
 						params["overwrite"] = "true"
 						// if the description is not set, we need to create it
 					}
 					switch params["overwrite"] {
 					case "false":
-						event.SetProperty(ics.ComponentPropertyLocation, event.GetProperty(ics.ComponentPropertyLocation).Value+"; "+params["new-location"])
+						item.SetProperty(ics.ComponentPropertyLocation, item.GetProperty(ics.ComponentPropertyLocation).Value+"; "+params["new-location"])
 					case "fillempty":
-						if event.GetProperty(ics.ComponentPropertyLocation).Value == "" {
-							event.SetProperty(ics.ComponentPropertyLocation, params["new-location"])
+						if item.GetProperty(ics.ComponentPropertyLocation).Value == "" {
+							item.SetProperty(ics.ComponentPropertyLocation, params["new-location"])
 						}
 					case "true":
-						event.SetProperty(ics.ComponentPropertyLocation, params["new-location"])
+						item.SetProperty(ics.ComponentPropertyLocation, params["new-location"])
 					}
-					log.Debug("Changed location to " + event.GetProperty(ics.ComponentPropertyLocation).Value)
+					log.Debug("Changed location to " + item.GetProperty(ics.ComponentPropertyLocation).Value)
 				}
-				if params["new-start"] != "" {
-					start, err := time.Parse(time.RFC3339, params["new-start"])
-					if err != nil {
-						return 0, fmt.Errorf("invalid start time: %s", err.Error())
-					}
-					event.SetStartAt(start)
-					log.Debug("Changed start to " + params["new-start"])
-				}
-				if params["new-end"] != "" {
-					end, err := time.Parse(time.RFC3339, params["new-end"])
-					if err != nil {
-						return 0, fmt.Errorf("invalid end time: %s", err.Error())
-					}
-					event.SetEndAt(end)
-					log.Debug("Changed end to " + params["new-end"])
+				err := applyTimeEdits(cal.Components[i], params, loc)
+				if err != nil {
+					return 0, err
 				}
-				// adding edited event back to calendar
-				cal.Components[i] = event
 				return 0, nil
 			}
 		}
@@ -471,14 +792,17 @@ func moduleEditId(cal *ics.Calendar, params map[string]string) (int, error) {
 // Edits all Events with the matching regex title.
 // Parameters:
 // - 'id', mandatory: the id of the event to edit
-// - 'after', optional: beginning of search timeframe
-// - 'before', optional: end of search timeframe
+// - 'after', optional: beginning of search timeframe, as time expression
+// - 'before', optional: end of search timeframe, as time expression
+// - 'period', optional: name of a period from the config to use as timeframe, 'after' and 'before' override it
 // - 'overwrite', default true: overwrite existing event properties with the new ones. If false, it will be appended to the existing property. Does not apply to 'new-start' and 'new-end'
 // - 'new-summary', optional: the new summary
 // - 'new-description', optional: the new description
-// - 'new-start', optional: the new start time in RFC3339 format "2006-01-02T15:04:05Z"
-// - 'new-end', optional: the new end time in RFC3339 format "2006-01-02T15:04:05Z"
+// - 'new-start', optional: the new start time as time expression, e.g. "2006-01-02T15:04:05Z", or a date "2006-01-02" for all-day events
+// - 'new-end', optional: the new end time as time expression, e.g. "2006-01-02T15:04:05Z", or a date "2006-01-02" for all-day events (exclusive)
+// - 'new-allday', optional: "true" turns the events into all-day events on the same days, "false" into timed events
 // - 'new-location', optional: the new location
+// - 'move-time', optional: duration to move the events by. All-day events can only be moved by whole days ("24h")
 // The return value is the number of events removed or added (should always be 0)
 func moduleEditSummaryRegex(cal *ics.Calendar, params map[string]string) (int, error) {
 	// parse regex
@@ -489,30 +813,13 @@ func moduleEditSummaryRegex(cal *ics.Calendar, params map[string]string) (int, e
 	if err != nil {
 		return 0, fmt.Errorf("invalid regex: %s", err.Error())
 	}
-	// parse timespan
-	var after time.Time
-	var before time.Time
-	if params["after"] == "" {
-		log.Debug("No after time given. Using time 0.\n")
-		after = time.Time{}
-	} else if params["after"] == "now" {
-		after = time.Now()
-	} else {
-		after, err = time.Parse(time.RFC3339, params["start"])
-		if err != nil {
-			return 0, fmt.Errorf("invalid start time: %s", err.Error())
-		}
+	loc, err := getParamLocation(params)
+	if err != nil {
+		return 0, err
 	}
-	if params["before"] == "" {
-		log.Debug("No end time given. Using max time\n")
-		before = time.Unix(1<<63-1-int64((1969*365+1969/4-1969/100+1969/400)*24*60*60), 999999999)
-	} else if params["before"] == "now" {
-		before = time.Now()
-	} else {
-		before, err = time.Parse(time.RFC3339, params["before"])
-		if err != nil {
-			return 0, fmt.Errorf("invalid end time: %s", err.Error())
-		}
+	after, before, err := parseTimeframe(params, "after", "before", loc)
+	if err != nil {
+		return 0, err
 	}
 
 	// parse move-time
@@ -523,94 +830,71 @@ func moduleEditSummaryRegex(cal *ics.Calendar, params map[string]string) (int, e
 	// iterate over events backwards
 	for i := len(cal.Components) - 1; i >= 0; i-- {
 		switch cal.Components[i].(type) {
-		case *ics.VEvent:
-			event := cal.Components[i].(*ics.VEvent)
-			date, _ := event.GetStartAt()
-			if date.After(after) && before.After(date) {
-				if re.MatchString(event.GetProperty(ics.ComponentPropertySummary).Value) {
-					log.Debug("Changing event with id " + event.Id())
+		case *ics.VEvent, *ics.VTodo, *ics.VJournal:
+			item := getItemBase(cal.Components[i])
+			inTimeframe, err := eventInTimeframe(cal.Components[i], after, before, loc)
+			if err != nil {
+				log.Warnf("Skipping event: %s", err.Error())
+				continue
+			}
+			if inTimeframe {
+				if re.MatchString(getPropertyValue(item, ics.ComponentPropertySummary)) {
+					log.Debug("Changing event with id " + getItemId(item))
 					if params["new-summary"] != "" {
-						if event.GetProperty(ics.ComponentPropertySummary) == nil {
+						if item.GetProperty(ics.ComponentPropertySummary) == nil {
 							params["overwrite"] = "true"
 							// if the summary is not set, we need to create it
 						}
 						switch params["overwrite"] {
 						case "false":
-							event.SetProperty(ics.ComponentPropertySummary, event.GetProperty(ics.ComponentPropertySummary).Value+"; "+params["new-summary"])
+							item.SetProperty(ics.ComponentPropertySummary, item.GetProperty(ics.ComponentPropertySummary).Value+"; "+params["new-summary"])
 						case "fillempty":
-							if event.GetProperty(ics.ComponentPropertySummary).Value == "" {
-								event.SetProperty(ics.ComponentPropertySummary, params["new-summary"])
+							if item.GetProperty(ics.ComponentPropertySummary).Value == "" {
+								item.SetProperty(ics.ComponentPropertySummary, params["new-summary"])
 							}
 						case "true":
-							event.SetProperty(ics.ComponentPropertySummary, params["new-summary"])
+							item.SetProperty(ics.ComponentPropertySummary, params["new-summary"])
 						}
-						log.Debug("Changed summary to " + event.GetProperty(ics.ComponentPropertySummary).Value)
+						log.Debug("Changed summary to " + item.GetProperty(ics.ComponentPropertySummary).Value)
 					}
 					if params["new-description"] != "" {
-						if event.GetProperty(ics.ComponentPropertyDescription) == nil {
+						if item.GetProperty(ics.ComponentPropertyDescription) == nil {
 							params["overwrite"] = "true"
 							// if the description is not set, we need to create it
 						}
 						switch params["overwrite"] {
 						case "false":
-							event.SetProperty(ics.ComponentPropertyDescription, event.GetProperty(ics.ComponentPropertyDescription).Value+"; "+params["new-description"])
+							item.SetProperty(ics.ComponentPropertyDescription, item.GetProperty(ics.ComponentPropertyDescription).Value+"; "+params["new-description"])
 						case "fillempty":
-							if event.GetProperty(ics.ComponentPropertyDescription).Value == "" {
-								event.SetProperty(ics.ComponentPropertyDescription, params["new-description"])
+							if item.GetProperty(ics.ComponentPropertyDescription).Value == "" {
+								item.SetProperty(ics.ComponentPropertyDescription, params["new-description"])
 							}
 						case "true":
-							event.SetProperty(ics.ComponentPropertyDescription, params["new-description"])
+							item.SetProperty(ics.ComponentPropertyDescription, params["new-description"])
 						}
-						log.Debug("Changed description to " + event.GetProperty(ics.ComponentPropertyDescription).Value)
+						log.Debug("Changed description to " + item.GetProperty(ics.ComponentPropertyDescription).Value)
 					}
 					if params["new-location"] != "" {
-						if event.GetProperty(ics.ComponentPropertyLocation) == nil {
+						if item.GetProperty(ics.ComponentPropertyLocation) == nil {
 							params["overwrite"] = "true"
 							// if the description is not set, we need to create it
 						}
 						switch params["overwrite"] {
 						case "false":
-							event.SetProperty(ics.ComponentPropertyLocation, event.GetProperty(ics.ComponentPropertyLocation).Value+"; "+params["new-location"])
+							item.SetProperty(ics.ComponentPropertyLocation, item.GetProperty(ics.ComponentPropertyLocation).Value+"; "+params["new-location"])
 						case "fillempty":
-							if event.GetProperty(ics.ComponentPropertyLocation).Value == "" {
-								event.SetProperty(ics.ComponentPropertyLocation, params["new-location"])
+							if item.GetProperty(ics.ComponentPropertyLocation).Value == "" {
+								item.SetProperty(ics.ComponentPropertyLocation, params["new-location"])
 							}
 						case "true":
-							event.SetProperty(ics.ComponentPropertyLocation, params["new-location"])
-						}
-						log.Debug("Changed location to " + event.GetProperty(ics.ComponentPropertyLocation).Value)
-					}
-					if params["new-start"] != "" {
-						start, err := time.Parse(time.RFC3339, params["new-start"])
-						if err != nil {
-							return 0, fmt.Errorf("invalid start time: %s", err.Error())
-						}
-						event.SetStartAt(start)
-						log.Debug("Changed start to " + params["new-start"])
-					}
-					if params["new-end"] != "" {
-						end, err := time.Parse(time.RFC3339, params["new-end"])
-						if err != nil {
-							return 0, fmt.Errorf("invalid end time: %s", err.Error())
+							item.SetProperty(ics.ComponentPropertyLocation, params["new-location"])
 						}
-						event.SetEndAt(end)
-						log.Debug("Changed end to " + params["new-end"])
+						log.Debug("Changed location to " + item.GetProperty(ics.ComponentPropertyLocation).Value)
 					}
-					if params["move-time"] != "" {
-						dur, err := time.ParseDuration(params["move-time"])
-						if err != nil {
-							return 0, fmt.Errorf("invalid duration: %s", err.Error())
-						}
-						start, _ := event.GetStartAt()
-						log.Debug("Starttime is " + start.String())
-						end, _ := event.GetEndAt()
-						event.SetStartAt(start.Add(dur))
-						log.Debug("Changed start to " + start.Add(dur).String())
-						event.SetEndAt(end.Add(dur))
-						log.Debug("Changed start and end by " + dur.String())
+					err := applyTimeEdits(cal.Components[i], params, loc)
+					if err != nil {
+						return 0, err
 					}
-					// adding edited event back to calendar
-					cal.Components[i] = event
 				}
 			}
 		}
@@ -618,20 +902,16 @@ func moduleEditSummaryRegex(cal *ics.Calendar, params map[string]string) (int, e
 	return 0, nil
 }
 
+// This module adds one alarm to all events. It is kept for old configs and the ?reminder= query, see moduleAlarm.
+// Parameters:
+// - 'time', mandatory: time before the start of the event, e.g. "15M" or "1H30M" (appended to "-PT"), or a trigger of the alarm module
+// Returns the number of events removed or added (always 0).
 func moduleAddAllReminder(cal *ics.Calendar, params map[string]string) (int, error) {
-	// add reminder to calendar
-	for i := len(cal.Components) - 1; i >= 0; i-- {
-		switch cal.Components[i].(type) {
-		case *ics.VEvent:
-			event := cal.Components[i].(*ics.VEvent)
-			event.AddAlarm()
-			event.Alarms()[0].SetTrigger(("-PT" + params["time"]))
-			event.Alarms()[0].SetAction("DISPLAY")
-			cal.Components[i] = event
-			log.Debug("Added reminder to event " + event.Id())
-		}
+	trigger, err := parseLegacyReminder(params["time"])
+	if err != nil {
+		return 0, err
 	}
-	return 0, nil
+	return moduleAlarm(cal, map[string]string{"triggers": trigger.value})
 }
 
 // removes the element at index i from ics.Component slice
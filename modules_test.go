@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	ics "github.com/arran4/golang-ical"
+	log "github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+)
+
+// itemIds returns the UIDs of all events, todos and journal entries in the calendar, in order
+func itemIds(cal *ics.Calendar) string {
+	var ids []string
+	for _, component := range cal.Components {
+		if item := getItemBase(component); item != nil {
+			ids = append(ids, getItemId(item))
+		}
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestModuleDeleteDuplicatesItems(t *testing.T) {
+	cal := testCalendar(t, `BEGIN:VTODO
+UID:todo-1
+DTSTAMP:20240101T000000Z
+DUE:20240105T100000Z
+SUMMARY:Abgabe
+END:VTODO
+BEGIN:VTODO
+UID:todo-2
+DTSTAMP:20240101T000000Z
+DUE:20240105T100000Z
+SUMMARY:Abgabe
+END:VTODO
+BEGIN:VTODO
+UID:todo-3
+DTSTAMP:20240101T000000Z
+SUMMARY:Abgabe
+END:VTODO
+BEGIN:VEVENT
+UID:event-1
+DTSTAMP:20240101T000000Z
+DTSTART:20240105T100000Z
+DTEND:20240105T100000Z
+SUMMARY:Abgabe
+END:VEVENT
+BEGIN:VJOURNAL
+UID:journal-1
+DTSTAMP:20240101T000000Z
+SUMMARY:Notiz
+END:VJOURNAL
+BEGIN:VJOURNAL
+UID:journal-2
+DTSTAMP:20240101T000000Z
+SUMMARY:Notiz
+END:VJOURNAL`)
+	count, err := moduleDeleteDuplicates(cal, map[string]string{"timezone": "UTC"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the event with the same times as the todos isn't a duplicate, neither is the todo without dates
+	if got := itemIds(cal); count != -2 || got != "todo-2,todo-3,event-1,journal-2" {
+		t.Errorf("moduleDeleteDuplicates = %d, kept %s", count, got)
+	}
+}
+
+func TestModuleDeleteDuplicatesReport(t *testing.T) {
+	hook := logtest.NewGlobal()
+	defer hook.Reset()
+	event := "BEGIN:VEVENT\nUID:%s\nDTSTAMP:20240101T000000Z\nDTSTART:20240105T100000Z\nDTEND:20240105T120000Z\nSUMMARY:Analysis\nEND:VEVENT"
+	cal := testCalendar(t, fmt.Sprintf(event, "internal-1")+"\n"+fmt.Sprintf(event, "internal-2"))
+	if _, err := moduleDeleteDuplicates(cal, map[string]string{"report": "true", "timezone": "UTC"}); err != nil {
+		t.Fatal(err)
+	}
+	if serialized := cal.Serialize(); strings.Contains(serialized, "internal-1") || strings.Contains(serialized, "X-ICAL-RELAY") {
+		t.Errorf("the report was written to the feed:\n%s", serialized)
+	}
+	var reported bool
+	for _, entry := range hook.AllEntries() {
+		if entry.Level == log.InfoLevel && entry.Message == "Duplicates of internal-2: internal-1" {
+			reported = true
+		}
+	}
+	if !reported {
+		t.Error("the duplicates weren't logged")
+	}
+}
+
+func TestModuleDeleteDuplicatesStrategies(t *testing.T) {
+	events := strings.Join([]string{
+		testEvent("a-1", "Analysis", "20240105T100000", "20240105T120000", "LOCATION:HS1", "CATEGORIES:Mathe"),
+		testEvent("b-1", "Physik", "20240105T100000", "20240105T120000"),
+		testEvent("a-2", "Analysis", "20240105T100500", "20240105T120000", "LOCATION:HS2", "DESCRIPTION:verlegt", "CATEGORIES:Vorlesung"),
+		testEvent("a-3", "Analysis", "20240105T100000", "20240105T120000", "LOCATION:HS1"),
+		testEvent("a-4", "Analysis", "20240106T100000", "20240106T120000", "LOCATION:HS1"),
+	}, "\n")
+	tests := []struct {
+		params    map[string]string
+		wantCount int
+		wantIds   string
+	}{
+		// a-2 starts 5 minutes later, so it is only a duplicate with tolerance
+		{map[string]string{}, -1, "b-1,a-2,a-3,a-4"},
+		{map[string]string{"strategy": "keep-last"}, -1, "b-1,a-2,a-3,a-4"},
+		{map[string]string{"strategy": "keep-first"}, -1, "a-1,b-1,a-2,a-4"},
+		{map[string]string{"tolerance": "5m"}, -2, "b-1,a-3,a-4"},
+		{map[string]string{"tolerance": "4m59s"}, -1, "b-1,a-2,a-3,a-4"},
+		{map[string]string{"tolerance": "5m", "strategy": "keep-first"}, -2, "a-1,b-1,a-4"},
+		// all keys have to be equal
+		{map[string]string{"tolerance": "5m", "keys": "SUMMARY,LOCATION"}, -1, "b-1,a-2,a-3,a-4"},
+		{map[string]string{"keys": "DTSTAMP"}, -2, "a-2,a-3,a-4"},
+		{map[string]string{"tolerance": "5m", "mode": "cancel"}, 0, "a-1,b-1,a-2,a-3,a-4"},
+	}
+	for _, test := range tests {
+		cal := testCalendar(t, events)
+		test.params["timezone"] = "UTC"
+		count, err := moduleDeleteDuplicates(cal, test.params)
+		if err != nil {
+			t.Errorf("moduleDeleteDuplicates(%v): unexpected error: %v", test.params, err)
+			continue
+		}
+		if got := itemIds(cal); count != test.wantCount || got != test.wantIds {
+			t.Errorf("moduleDeleteDuplicates(%v) = %d %s, want %d %s", test.params, count, got, test.wantCount, test.wantIds)
+		}
+	}
+
+	// merge keeps the latest event and adds the locations, descriptions and categories of the duplicates
+	cal := testCalendar(t, events)
+	count, err := moduleDeleteDuplicates(cal, map[string]string{"tolerance": "5m", "strategy": "merge", "timezone": "UTC"})
+	if err != nil || count != -2 || itemIds(cal) != "b-1,a-3,a-4" {
+		t.Fatalf("moduleDeleteDuplicates with merge = %d %s, %v", count, itemIds(cal), err)
+	}
+	merged := getItemBase(cal.Components[1])
+	if location := ics.FromText(getPropertyValue(merged, ics.ComponentPropertyLocation)); location != "HS1, HS2" {
+		t.Errorf("merged location = %q", location)
+	}
+	if description := ics.FromText(getPropertyValue(merged, ics.ComponentPropertyDescription)); description != "verlegt" {
+		t.Errorf("merged description = %q", description)
+	}
+	if categories := strings.Join(getCategories(merged), ","); categories != "Vorlesung,Mathe" {
+		t.Errorf("merged categories = %q", categories)
+	}
+
+	for _, params := range []map[string]string{{"strategy": "newest"}, {"tolerance": "-1m"}, {"tolerance": "soon"}, {"report": "yes"}, {"mode": "drop"}} {
+		if _, err := moduleDeleteDuplicates(testCalendar(t, events), params); err == nil {
+			t.Errorf("moduleDeleteDuplicates(%v): expected an error", params)
+		}
+	}
+}
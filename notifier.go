@@ -7,7 +7,6 @@ import (
 
 	"gopkg.in/gomail.v2"
 
-	ics "github.com/arran4/golang-ical"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -35,7 +34,7 @@ func notifyChanges(id string, n *notifier) error {
 		requestLogger.Errorln("error opening calendar1 file: " + err.Error())
 		return err
 	}
-	calendar1, err := ics.ParseCalendar(file1)
+	calendar1, err := parseCalendar(file1)
 	if err != nil {
 		requestLogger.Errorln("error parsing calendar1 file: " + err.Error())
 		return err
@@ -56,20 +55,21 @@ func notifyChanges(id string, n *notifier) error {
 		log.Debug("Changes detected: " + fmt.Sprint(len(added)) + " added, " + fmt.Sprint(len(deleted)) + " deleted, " + fmt.Sprint(len(changed)) + " changed")
 
 		var body string
+		loc := conf.getNotifierLocation(id, *n)
 
 		if len(added) > 0 {
 			for _, event := range added {
-				body += "Added:\n\n" + prettyPrint(event) + "\n\n"
+				body += "Added:\n\n" + prettyPrint(event, loc) + "\n\n"
 			}
 		}
 		if len(deleted) > 0 {
 			for _, event := range deleted {
-				body += "Deleted:\n\n" + prettyPrint(event) + "\n\n"
+				body += "Deleted:\n\n" + prettyPrint(event, loc) + "\n\n"
 			}
 		}
 		if len(changed) > 0 {
 			for _, event := range changed {
-				body += "Changed (displaying new version):\n\n" + prettyPrint(event) + "\n\n"
+				body += "Changed (displaying new version):\n\n" + prettyPrint(event, loc) + "\n\n"
 			}
 		}
 
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	ics "github.com/arran4/golang-ical"
+	log "github.com/sirupsen/logrus"
+)
+
+// getTimeframe returns start and end of the period, read in loc.
+// If 'until' is a date without time, the whole day is part of the period.
+func (p period) getTimeframe(loc *time.Location) (time.Time, time.Time, error) {
+	if p.From == "" || p.Until == "" {
+		return time.Time{}, time.Time{}, fmt.Errorf("'from' and 'until' are mandatory")
+	}
+	from, err := parseTimeExpression(p.From, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid start: %s", err.Error())
+	}
+	until, err := parseTimeExpression(p.Until, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid end: %s", err.Error())
+	}
+	if _, err := time.Parse("2006-01-02", p.Until); err == nil {
+		until = until.AddDate(0, 0, 1)
+	}
+	if until.Before(from) {
+		return time.Time{}, time.Time{}, fmt.Errorf("end is before start")
+	}
+	return from, until, nil
+}
+
+// getPeriodTimeframe returns start and end of the named period from the config, read in loc.
+func getPeriodTimeframe(name string, loc *time.Location) (time.Time, time.Time, error) {
+	p, ok := conf.Periods[name]
+	if !ok {
+		return time.Time{}, time.Time{}, fmt.Errorf("period '%s' doesn't exist", name)
+	}
+	from, until, err := p.getTimeframe(loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("invalid period '%s': %s", name, err.Error())
+	}
+	return from, until, nil
+}
+
+// This module deletes or tags all events, todos and journal entries that start in a named period from the config.
+// Todos without DTSTART start at DUE, todos and journal entries without any date are treated as outside of the period.
+// Parameters:
+// - 'period', mandatory: name of the period
+// - 'action', default "delete": "delete" removes the events, "tag" adds 'category' and 'prefix' to them
+// - 'mode', default "delete": with action "delete", "delete" removes the events, "cancel" keeps them with STATUS:CANCELLED
+// and an increased SEQUENCE
+// - 'category', optional: category added to the events with action "tag"
+// - 'prefix', optional: text prepended to the summary of the events with action "tag", or of cancelled events
+// - 'invert', default false: if "true", the events outside of the period are deleted or tagged
+// Returns the number of events removed.
+func modulePeriod(cal *ics.Calendar, params map[string]string) (int, error) {
+	var count int
+	if params["period"] == "" {
+		return 0, fmt.Errorf("missing mandatory Parameter 'period'")
+	}
+	if params["action"] == "" {
+		params["action"] = "delete"
+	}
+	if params["action"] != "delete" && params["action"] != "tag" {
+		return 0, fmt.Errorf("invalid action '%s', must be 'delete' or 'tag'", params["action"])
+	}
+	if params["action"] == "tag" && params["category"] == "" && params["prefix"] == "" {
+		return 0, fmt.Errorf("action 'tag' needs at least one of the Parameters 'category' or 'prefix'")
+	}
+	if err := checkDeleteMode(params); err != nil {
+		return 0, err
+	}
+	loc, err := getParamLocation(params)
+	if err != nil {
+		return 0, err
+	}
+	from, until, err := getPeriodTimeframe(params["period"], loc)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := len(cal.Components) - 1; i >= 0; i-- { // iterate over events backwards
+		item := getItemBase(cal.Components[i])
+		if item == nil {
+			continue
+		}
+		// todos and journal entries without dates are never in the period
+		start, _, _, err := getItemTimes(cal.Components[i], loc)
+		if err != nil && err != errUndated {
+			log.Warnf("Skipping event: %s", err.Error())
+			continue
+		}
+		inPeriod := err == nil && !start.Before(from) && start.Before(until)
+		if inPeriod == (params["invert"] == "true") {
+			continue
+		}
+		switch params["action"] {
+		case "delete":
+			count += deleteOrCancelEvent(cal, i, params)
+		case "tag":
+			if params["category"] != "" {
+				addCategory(item, params["category"])
+			}
+			if params["prefix"] != "" {
+				item.SetProperty(ics.ComponentPropertySummary, ics.ToText(params["prefix"])+getPropertyValue(item, ics.ComponentPropertySummary))
+			}
+			log.Debug("Tagged " + getItemType(cal.Components[i]) + " with id " + getItemId(item) + " in period " + params["period"] + "\n")
+		}
+	}
+	return count, nil
+}
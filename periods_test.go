@@ -0,0 +1,31 @@
+package main
+
+import (
+	"testing"
+
+	ics "github.com/arran4/golang-ical"
+)
+
+func TestModulePeriodTagPrefix(t *testing.T) {
+	oldConf := conf
+	defer func() { conf = oldConf }()
+	conf.Periods = map[string]period{"ws": {From: "2024-10-01", Until: "2025-04-01"}}
+
+	cal := testCalendar(t, `BEGIN:VEVENT
+UID:lecture-1
+DTSTAMP:20240101T000000Z
+DTSTART:20241015T100000Z
+DTEND:20241015T120000Z
+SUMMARY:Analysis\, Teil 1
+END:VEVENT`)
+	if _, err := modulePeriod(cal, map[string]string{"period": "ws", "action": "tag", "prefix": "[WS 24/25; Gruppe A, B] ", "timezone": "UTC"}); err != nil {
+		t.Fatal(err)
+	}
+	item := &cal.Events()[0].ComponentBase
+	if got := getPropertyValue(item, ics.ComponentPropertySummary); got != `[WS 24/25\; Gruppe A\, B] Analysis\, Teil 1` {
+		t.Errorf("tagged SUMMARY = %q", got)
+	}
+	if got := ics.FromText(getPropertyValue(item, ics.ComponentPropertySummary)); got != "[WS 24/25; Gruppe A, B] Analysis, Teil 1" {
+		t.Errorf("tagged summary = %q", got)
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"net/http"
 	"os"
 	"sort"
+	"strings"
+	"time"
 
 	ics "github.com/arran4/golang-ical"
 	log "github.com/sirupsen/logrus"
@@ -46,12 +48,40 @@ func getProfilesMetadata() []profileMetadata {
 	return profiles
 }
 
+// prefix of sources, which use the calendar of another profile of the relay, e.g. "profile:faculty"
+const profileSourcePrefix = "profile:"
+
 func getProfileCalendar(profile profile, profileName string) (*ics.Calendar, error) {
+	return buildProfileCalendar(profile, profileName, nil)
+}
+
+// buildProfileCalendar gets the source of the profile and applies its modules, after resolving the profile it extends.
+// chain contains the profiles currently being built, which include this one, to detect cycles.
+func buildProfileCalendar(profile profile, profileName string, chain []string) (*ics.Calendar, error) {
 	var calendar *ics.Calendar
+	if contains(chain, profileName) {
+		return nil, fmt.Errorf("profile '%s' includes itself: %s", profileName, strings.Join(append(chain, profileName), " -> "))
+	}
+	chain = append(append([]string{}, chain...), profileName)
+	profile, err := conf.resolveProfile(profile)
+	if err != nil {
+		return nil, err
+	}
 
 	// get the base calendar to which to apply modules
 	if profile.Source == "" {
 		calendar = ics.NewCalendar()
+	} else if strings.HasPrefix(profile.Source, profileSourcePrefix) {
+		sourceName := strings.TrimPrefix(profile.Source, profileSourcePrefix)
+		source, ok := conf.Profiles[sourceName]
+		if !ok {
+			return nil, fmt.Errorf("source profile '%s' doesn't exist", sourceName)
+		}
+		var err error
+		calendar, err = buildProfileCalendar(source, sourceName, chain)
+		if err != nil {
+			return nil, err
+		}
 	} else {
 		response, err := http.Get(profile.Source)
 		if err != nil {
@@ -63,23 +93,34 @@ func getProfileCalendar(profile profile, profileName string) (*ics.Calendar, err
 		if err != nil {
 			return nil, err
 		}
-		calendar, err = ics.ParseCalendar(response.Body)
+		calendar, err = parseCalendar(response.Body)
 		if err != nil {
 			return nil, err
 		}
 	}
 
 	// apply modules
-	origlen := len(calendar.Events())
+	origlen := countItems(calendar)
 	var addedEvents int
 
 	for _, module_request := range profile.Modules {
+		if module_request["disabled"] == "true" {
+			log.Debug("Skipping disabled module: ", module_request["name"])
+			continue
+		}
 		log.Debug("Requested module: ", module_request["name"])
 		module, ok := modules[module_request["name"]]
 		if !ok {
 			return nil, fmt.Errorf("module '%s' doesn't exist", module_request["name"])
 		}
-		count, err := callModule(module, module_request, calendar)
+		var count int
+		var err error
+		if module_request["name"] == "add-profile" {
+			// the included profile needs the chain for the cycle detection
+			count, err = addProfileEvents(calendar, getModuleParams(profile, module_request), chain)
+		} else {
+			count, err = callModule(module, getModuleParams(profile, module_request), calendar)
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -88,12 +129,12 @@ func getProfileCalendar(profile profile, profileName string) (*ics.Calendar, err
 
 	// immutable past:
 	historyFilename := conf.Server.StoragePath + "calstore/" + profileName + "-past.ics"
-	if profile.ImmutablePast {
+	if profile.hasImmutablePast() {
 		// check if file exists, if not download for the first time
 		if _, err := os.Stat(historyFilename); os.IsNotExist(err) {
 			log.Info("History file does not exist, saving for the first time")
 			historyCal := calendar
-			_, err := moduleDeleteTimeframe(historyCal, map[string]string{"after": "now"})
+			_, err := moduleDeleteTimeframe(historyCal, map[string]string{"after": "now", "timezone": conf.getProfileLocation(profile).String()})
 			if err != nil {
 				log.Errorln(err)
 				return calendar, fmt.Errorf("Error executing immutable past (first-run): %s", err.Error())
@@ -110,7 +151,7 @@ func getProfileCalendar(profile profile, profileName string) (*ics.Calendar, err
 		}
 		log.Debug("Removing future from history file")
 		// delete events from historyCal that are in the future
-		_, err = moduleDeleteTimeframe(historyCal, map[string]string{"after": "now"})
+		_, err = moduleDeleteTimeframe(historyCal, map[string]string{"after": "now", "timezone": conf.getProfileLocation(profile).String()})
 		if err != nil {
 			log.Errorln(err)
 			return calendar, fmt.Errorf("Error executing immutable past (setup): %s", err.Error())
@@ -118,7 +159,7 @@ func getProfileCalendar(profile profile, profileName string) (*ics.Calendar, err
 
 		// delete events from calendar that are in the past
 		log.Debug("Removing past from calendar")
-		count, err := moduleDeleteTimeframe(calendar, map[string]string{"before": "now"})
+		count, err := moduleDeleteTimeframe(calendar, map[string]string{"before": "now", "timezone": conf.getProfileLocation(profile).String()})
 		if err != nil {
 			log.Errorln(err)
 			return calendar, fmt.Errorf("Error executing immutable past (delete): %s", err.Error())
@@ -144,10 +185,86 @@ func getProfileCalendar(profile profile, profileName string) (*ics.Calendar, err
 	// it may be neccesary to run delete-duplicates here to avoid duplicates from the history file
 
 	// make sure new calendar has all events but excluded and added
-	eventCountDiff := origlen + addedEvents - len(calendar.Events())
+	eventCountDiff := origlen + addedEvents - countItems(calendar)
 	if eventCountDiff != 0 {
-		log.Warnf("Calendar has %d events after applying modules, but should have %d", len(calendar.Events()), origlen+addedEvents)
+		log.Warnf("Calendar has %d events after applying modules, but should have %d", countItems(calendar), origlen+addedEvents)
 	}
 	log.Debugf("Added %d events", addedEvents)
 	return calendar, nil
 }
+
+// getModuleParams copies the module parameters from the config and adds the profile defaults, so they don't end up in the config.
+// Modules without their own 'timezone' get the profile timezone.
+func getModuleParams(profile profile, module map[string]string) map[string]string {
+	params := make(map[string]string, len(module)+1)
+	for k, v := range module {
+		params[k] = v
+	}
+	if params["timezone"] == "" {
+		params["timezone"] = conf.getProfileLocation(profile).String()
+	}
+	return params
+}
+
+// validate checks the metadata of a profile, before it is saved or used
+func (m calendarMetadata) validate() error {
+	if m.Color != "" && !colorNameRegex.MatchString(m.Color) {
+		return fmt.Errorf("invalid color '%s', must be a CSS color name like 'crimson'", m.Color)
+	}
+	if m.RefreshInterval != "" {
+		d, err := time.ParseDuration(m.RefreshInterval)
+		if err != nil {
+			return fmt.Errorf("invalid refresh-interval: %s", err.Error())
+		}
+		if d < time.Minute {
+			return fmt.Errorf("invalid refresh-interval: must be at least 1m")
+		}
+	}
+	return nil
+}
+
+// setRefreshInterval replaces the REFRESH-INTERVAL of the calendar. RFC 7986 requires the VALUE=DURATION parameter, strict
+// clients ignore it otherwise. golang-ical has the parameter in the property name, so REFRESH-INTERVALs parsed from the source
+// aren't replaced by SetRefreshInterval and the parameter would be lost, if the library changes.
+func setRefreshInterval(calendar *ics.Calendar, interval string) {
+	var properties []ics.CalendarProperty
+	for _, p := range calendar.CalendarProperties {
+		if p.IANAToken != "REFRESH-INTERVAL" && p.IANAToken != string(ics.PropertyRefreshInterval) {
+			properties = append(properties, p)
+		}
+	}
+	calendar.CalendarProperties = append(properties, ics.CalendarProperty{BaseProperty: ics.BaseProperty{
+		IANAToken:      "REFRESH-INTERVAL",
+		ICalParameters: map[string][]string{string(ics.ParameterValue): {string(ics.ValueDataTypeDuration)}},
+		Value:          interval,
+	}})
+}
+
+// setCalendarMetadata sets the name, description, color and refresh interval of the profile on the calendar (RFC 7986),
+// and the PRODID of the relay. Without a configured name, the profile name is used, so clients don't show "Untitled".
+// The X-WR- and X-PUBLISHED-TTL properties are set, too, for clients that don't support RFC 7986.
+func setCalendarMetadata(calendar *ics.Calendar, profile profile, profileName string) {
+	calendar.SetProductId("-//jm-lemmi//ical-relay " + version + "//EN")
+	name := profile.Metadata.Name
+	if name == "" {
+		name = profileName
+	}
+	calendar.SetName(ics.ToText(name))
+	calendar.SetXWRCalName(ics.ToText(name))
+	if profile.Metadata.Description != "" {
+		calendar.SetDescription(profile.Metadata.Description)
+		calendar.SetXWRCalDesc(ics.ToText(profile.Metadata.Description))
+	}
+	if profile.Metadata.Color != "" {
+		calendar.SetColor(profile.Metadata.Color)
+	}
+	if profile.Metadata.RefreshInterval != "" {
+		interval, err := time.ParseDuration(profile.Metadata.RefreshInterval)
+		if err != nil {
+			log.Errorf("Invalid refresh-interval in profile %s: %v", profileName, err)
+			return
+		}
+		setRefreshInterval(calendar, formatICalDuration(interval))
+		calendar.SetXPublishedTTL(formatICalDuration(interval))
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	ics "github.com/arran4/golang-ical"
+)
+
+func TestCalendarMetadataValidate(t *testing.T) {
+	valid := []calendarMetadata{
+		{},
+		{Name: "Vorlesungen; WS", Description: "Alle Termine", Color: "crimson", RefreshInterval: "1h"},
+		{RefreshInterval: "1m"},
+	}
+	for _, m := range valid {
+		if err := m.validate(); err != nil {
+			t.Errorf("%+v: unexpected error: %v", m, err)
+		}
+	}
+	invalid := []calendarMetadata{
+		{Color: "#ff0000"},
+		{Color: "dark red"},
+		{RefreshInterval: "1 day"},
+		{RefreshInterval: "30s"},
+	}
+	for _, m := range invalid {
+		if err := m.validate(); err == nil {
+			t.Errorf("%+v: expected an error", m)
+		}
+	}
+}
+
+func TestSetCalendarMetadata(t *testing.T) {
+	cal, err := ics.ParseCalendar(strings.NewReader("BEGIN:VCALENDAR\r\nVERSION:2.0\r\nPRODID:-//Source//EN\r\n" +
+		"NAME:Quelle\r\nREFRESH-INTERVAL;VALUE=DURATION:PT6H\r\nX-PUBLISHED-TTL:PT6H\r\nEND:VCALENDAR\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	setCalendarMetadata(cal, profile{Metadata: calendarMetadata{Name: "Vorlesungen; WS", Color: "crimson", RefreshInterval: "1h"}}, "lectures")
+
+	var lines []string
+	for _, line := range strings.Split(cal.Serialize(), "\r\n") {
+		if strings.HasPrefix(line, "NAME") || strings.HasPrefix(line, "X-WR-CALNAME") || strings.HasPrefix(line, "COLOR") ||
+			strings.HasPrefix(line, "REFRESH-INTERVAL") || strings.HasPrefix(line, "X-PUBLISHED-TTL") {
+			lines = append(lines, line)
+		}
+	}
+	sort.Strings(lines)
+	want := []string{
+		"COLOR:crimson",
+		`NAME:Vorlesungen\; WS`,
+		// the interval of the source is replaced, VALUE=DURATION is written once
+		"REFRESH-INTERVAL;VALUE=DURATION:PT1H",
+		"X-PUBLISHED-TTL:PT1H",
+		`X-WR-CALNAME:Vorlesungen\; WS`,
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("calendar properties =\n%s\nwant\n%s", strings.Join(lines, "\n"), strings.Join(want, "\n"))
+	}
+
+	// without a configured name, the profile name is used
+	cal = ics.NewCalendar()
+	setCalendarMetadata(cal, profile{}, "lectures")
+	if serialized := cal.Serialize(); !strings.Contains(serialized, "NAME:lectures\r\n") || strings.Contains(serialized, "REFRESH-INTERVAL") {
+		t.Errorf("calendar without metadata:\n%s", serialized)
+	}
+}
+
+func TestBuildProfileCalendarIncludes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, strings.ReplaceAll("BEGIN:VCALENDAR\nVERSION:2.0\nPRODID:test\n"+
+			testEvent("lecture", "Vorlesung", "20240105T100000", "20240105T120000")+"\n"+
+			testEvent("exam", "Klausur", "20240205T100000", "20240205T120000")+"\nEND:VCALENDAR\n", "\n", "\r\n"))
+	}))
+	defer server.Close()
+
+	oldConf := conf
+	defer func() { conf = oldConf }()
+	conf = Config{Profiles: map[string]profile{
+		"faculty": {Source: server.URL},
+		// uses the calendar of faculty with its own modules
+		"exams": {Source: "profile:faculty", Modules: []map[string]string{{"name": "delete-bysummary-regex", "regex": "^Vorlesung$"}}},
+		"combined": {Modules: []map[string]string{
+			{"name": "add-profile", "profile": "exams"},
+			{"name": "add-profile", "profile": "faculty"},
+		}},
+		// a and b include each other
+		"a":       {Source: "profile:b"},
+		"b":       {Modules: []map[string]string{{"name": "add-profile", "profile": "a"}}},
+		"self":    {Modules: []map[string]string{{"name": "add-profile", "profile": "self"}}},
+		"missing": {Source: "profile:nowhere"},
+	}}
+
+	for name, want := range map[string]string{"faculty": "lecture,exam", "exams": "exam", "combined": "exam,lecture,exam"} {
+		cal, err := getProfileCalendar(conf.Profiles[name], name)
+		if err != nil {
+			t.Errorf("profile %s: unexpected error: %v", name, err)
+			continue
+		}
+		if got := itemIds(cal); got != want {
+			t.Errorf("items of profile %s = %s, want %s", name, got, want)
+		}
+	}
+
+	for name, want := range map[string]string{
+		"a":       "profile 'a' includes itself: a -> b -> a",
+		"self":    "profile 'self' includes itself: self -> self",
+		"missing": "source profile 'nowhere' doesn't exist",
+	} {
+		if _, err := getProfileCalendar(conf.Profiles[name], name); err == nil || err.Error() != want {
+			t.Errorf("profile %s: error %v, want %q", name, err, want)
+		}
+	}
+
+	// the config check finds the same cycles, before the profiles are built
+	for name, want := range map[string]string{
+		"combined": "",
+		"a":        "profile 'a' includes itself: a -> b -> a",
+		"b":        "profile 'b' includes itself: b -> a -> b",
+		"missing":  "included profile 'nowhere' doesn't exist",
+	} {
+		err := conf.checkIncludedProfiles(name, nil)
+		if (want == "" && err != nil) || (want != "" && (err == nil || err.Error() != want)) {
+			t.Errorf("checkIncludedProfiles(%s) = %v, want %q", name, err, want)
+		}
+	}
+
+	cal := ics.NewCalendar()
+	if _, err := moduleAddProfile(cal, map[string]string{}); err == nil {
+		t.Error("expected an error without profile")
+	}
+	if _, err := moduleAddProfile(cal, map[string]string{"profile": "nowhere"}); err == nil {
+		t.Error("expected an error for a missing profile")
+	}
+}
@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"time"
+
+	ics "github.com/arran4/golang-ical"
+	log "github.com/sirupsen/logrus"
+)
+
+// matches the name at the start of a content line, e.g. "DTSTART" in "DTSTART;TZID=Europe/Berlin:"
+var contentLineRegex = regexp.MustCompile(`^([A-Za-z][A-Za-z0-9-]*)[;:]`)
+
+// names of the properties of RFC 5545 and RFC 7986. Together with "X-" names, only lines starting with them are content lines,
+// so unfolded text like "NOTE: bring laptop" isn't taken for a property.
+var knownPropertyNames = []string{
+	"BEGIN", "END",
+	"CALSCALE", "METHOD", "PRODID", "VERSION",
+	"ATTACH", "CATEGORIES", "CLASS", "COMMENT", "DESCRIPTION", "GEO", "LOCATION", "PERCENT-COMPLETE", "PRIORITY", "RESOURCES", "STATUS", "SUMMARY",
+	"COMPLETED", "DTEND", "DUE", "DTSTART", "DURATION", "FREEBUSY", "TRANSP",
+	"TZID", "TZNAME", "TZOFFSETFROM", "TZOFFSETTO", "TZURL",
+	"ATTENDEE", "CONTACT", "ORGANIZER", "RECURRENCE-ID", "RELATED-TO", "URL", "UID",
+	"EXDATE", "EXRULE", "RDATE", "RRULE",
+	"ACTION", "REPEAT", "TRIGGER",
+	"CREATED", "DTSTAMP", "LAST-MODIFIED", "SEQUENCE", "REQUEST-STATUS",
+	"NAME", "REFRESH-INTERVAL", "SOURCE", "COLOR", "IMAGE", "CONFERENCE",
+}
+
+// isContentLine returns true, if the line starts with the name of a known property or an "X-" property
+func isContentLine(line string) bool {
+	m := contentLineRegex.FindStringSubmatch(line)
+	if m == nil {
+		return false
+	}
+	name := strings.ToUpper(m[1])
+	return strings.HasPrefix(name, "X-") || contains(knownPropertyNames, name)
+}
+
+// repairICSText fixes broken line folding and missing END lines, which make the whole calendar unparseable.
+// Lines that neither start a known property (see isContentLine) nor are folded with a leading space are joined to the
+// previous line as escaped line break, since they are usually multi-line descriptions. Empty lines are removed.
+func repairICSText(data string) string {
+	var lines []string
+	var open []string
+	for _, line := range strings.Split(strings.NewReplacer("\r\n", "\n", "\r", "\n").Replace(data), "\n") {
+		switch {
+		case strings.TrimSpace(line) == "":
+			continue
+		case strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t"):
+		case isContentLine(line):
+			if strings.HasPrefix(line, "BEGIN:") {
+				open = append(open, strings.TrimSpace(line[len("BEGIN:"):]))
+			} else if strings.HasPrefix(line, "END:") && len(open) > 0 {
+				open = open[:len(open)-1]
+			}
+		case len(lines) > 0:
+			lines[len(lines)-1] += `\n` + line
+			continue
+		}
+		lines = append(lines, line)
+	}
+	for i := len(open) - 1; i >= 0; i-- {
+		lines = append(lines, "END:"+open[i])
+	}
+	return strings.Join(lines, "\r\n") + "\r\n"
+}
+
+// parseCalendar parses a calendar. If it is malformed, it is repaired with repairICSText and parsed again.
+func parseCalendar(r io.Reader) (*ics.Calendar, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	cal, err := ics.ParseCalendar(bytes.NewReader(data))
+	if err == nil {
+		return cal, nil
+	}
+	repaired, repairErr := ics.ParseCalendar(strings.NewReader(repairICSText(string(data))))
+	if repairErr != nil {
+		return nil, err
+	}
+	log.Warnf("Repaired malformed calendar: %s", err.Error())
+	return repaired, nil
+}
+
+// parseRepairParams checks the parameters of the repair module and returns the default duration
+func parseRepairParams(params map[string]string) (time.Duration, error) {
+	duration := time.Hour
+	if params["default-duration"] != "" {
+		var err error
+		duration, err = time.ParseDuration(params["default-duration"])
+		if err != nil || duration < 0 {
+			return 0, fmt.Errorf("invalid value for 'default-duration': %s", params["default-duration"])
+		}
+	}
+	switch params["action"] {
+	case "", "fix", "drop":
+	default:
+		return 0, fmt.Errorf("invalid action '%s', must be 'fix' or 'drop'", params["action"])
+	}
+	if params["report"] != "" && params["report"] != "true" && params["report"] != "false" {
+		return 0, fmt.Errorf("invalid value for 'report': %s", params["report"])
+	}
+	return duration, nil
+}
+
+// repairIdentity adds a missing UID and DTSTAMP to an event, todo or journal entry. Returns the problems found.
+func repairIdentity(item *ics.ComponentBase) []string {
+	var problems []string
+	if getItemId(item) == "" {
+		problems = append(problems, "missing UID")
+		// derived from the content, so it is the same on every refresh
+		content := []string{
+			getPropertyValue(item, ics.ComponentPropertyDtStart),
+			getPropertyValue(item, ics.ComponentPropertySummary),
+			getPropertyValue(item, ics.ComponentPropertyLocation),
+			getPropertyValue(item, ics.ComponentPropertyDescription),
+		}
+		if due := getPropertyValue(item, ics.ComponentProperty(ics.PropertyDue)); due != "" {
+			content = append(content, due)
+		}
+		hash := sha256.Sum256([]byte(strings.Join(content, "\n")))
+		item.SetProperty(ics.ComponentPropertyUniqueId, fmt.Sprintf("repaired-%x@ical-relay", hash))
+	}
+	if item.GetProperty(ics.ComponentPropertyDtstamp) == nil {
+		problems = append(problems, "missing DTSTAMP")
+		stamp := getPropertyValue(item, ics.ComponentPropertyLastModified)
+		if stamp == "" {
+			stamp = getPropertyValue(item, ics.ComponentPropertyCreated)
+		}
+		if stamp != "" {
+			item.SetProperty(ics.ComponentPropertyDtstamp, stamp)
+		} else {
+			item.SetProperty(ics.ComponentPropertyDtstamp, time.Now().UTC().Format(icalDateTimeFormatUTC))
+		}
+	}
+	return problems
+}
+
+// repairEvent fixes the problems of the event, which can be fixed. Returns the problems found,
+// and whether the event can't be repaired (missing or invalid DTSTART).
+func repairEvent(event *ics.VEvent, loc *time.Location, defaultDuration time.Duration) ([]string, bool) {
+	start, allDay, err := parseICalTime(event.GetProperty(ics.ComponentPropertyDtStart), loc)
+	if err != nil {
+		return []string{"invalid DTSTART: " + err.Error()}, true
+	}
+	problems := repairIdentity(&event.ComponentBase)
+
+	endProp := event.GetProperty(ics.ComponentPropertyDtEnd)
+	durationProp := event.GetProperty(ics.ComponentProperty(ics.PropertyDuration))
+	if endProp != nil && durationProp != nil {
+		problems = append(problems, "both DTEND and DURATION")
+		removePropertyByName(&event.ComponentBase, ics.ComponentProperty(ics.PropertyDuration))
+		durationProp = nil
+	}
+	if endProp != nil {
+		if _, _, err := parseICalTime(endProp, loc); err != nil {
+			problems = append(problems, "invalid DTEND: "+err.Error())
+			removePropertyByName(&event.ComponentBase, ics.ComponentPropertyDtEnd)
+			endProp = nil
+		}
+	}
+	if durationProp != nil {
+		if _, err := parseICalDuration(durationProp.Value); err != nil {
+			problems = append(problems, "invalid DURATION: "+err.Error())
+			removePropertyByName(&event.ComponentBase, ics.ComponentProperty(ics.PropertyDuration))
+			durationProp = nil
+		}
+	}
+	if endProp == nil && durationProp == nil && !allDay {
+		problems = append(problems, "missing DTEND")
+		setEventTimes(event, start, start.Add(defaultDuration), false)
+	}
+
+	_, end, _, err := getEventTimes(event, loc)
+	if err == nil && end.Before(start) {
+		problems = append(problems, "DTEND before DTSTART")
+		// usually start and end were swapped
+		if endProp != nil {
+			setEventTimes(event, end, start, allDay)
+		} else {
+			removePropertyByName(&event.ComponentBase, ics.ComponentProperty(ics.PropertyDuration))
+			if !allDay {
+				setEventTimes(event, start, start.Add(defaultDuration), false)
+			}
+		}
+	}
+	return problems, false
+}
+
+// repairTodo fixes the problems of a todo or journal entry. Todos and journal entries without dates are valid,
+// so invalid dates are removed instead of dropping the item. Returns the problems found.
+func repairTodo(component ics.Component, loc *time.Location) []string {
+	item := getItemBase(component)
+	problems := repairIdentity(item)
+	for _, property := range []ics.ComponentProperty{ics.ComponentPropertyDtStart, ics.ComponentProperty(ics.PropertyDue)} {
+		if prop := item.GetProperty(property); prop != nil {
+			if _, _, err := parseICalTime(prop, loc); err != nil {
+				problems = append(problems, "invalid "+string(property)+": "+err.Error())
+				removePropertyByName(item, property)
+			}
+		}
+	}
+	if _, ok := component.(*ics.VTodo); !ok {
+		return problems
+	}
+	dueProp := item.GetProperty(ics.ComponentProperty(ics.PropertyDue))
+	if durationProp := item.GetProperty(ics.ComponentProperty(ics.PropertyDuration)); durationProp != nil {
+		if dueProp != nil {
+			problems = append(problems, "both DUE and DURATION")
+			removePropertyByName(item, ics.ComponentProperty(ics.PropertyDuration))
+		} else if _, err := parseICalDuration(durationProp.Value); err != nil || item.GetProperty(ics.ComponentPropertyDtStart) == nil {
+			problems = append(problems, "invalid DURATION")
+			removePropertyByName(item, ics.ComponentProperty(ics.PropertyDuration))
+		}
+	}
+	start, due, allDay, err := getItemTimes(component, loc)
+	if err == nil && item.GetProperty(ics.ComponentPropertyDtStart) != nil && dueProp != nil && due.Before(start) {
+		problems = append(problems, "DUE before DTSTART")
+		// usually start and due were swapped
+		setItemTimes(component, due, start, allDay)
+	}
+	return problems
+}
+
+// This module checks events, todos and journal entries for problems, which break clients or the views of the relay,
+// and fixes them or drops the items.
+// Fixes: missing UIDs are derived from the content, missing DTSTAMPs are taken from LAST-MODIFIED, CREATED or the current time,
+// missing or invalid ends get the default duration, swapped DTSTART and DTEND are swapped back and DURATION is removed,
+// if DTEND is set, too. Events without a valid DTSTART are always dropped. Invalid dates of todos and journal entries
+// are removed, since they may be undated, and swapped DTSTART and DUE are swapped back.
+// Malformed calendars, e.g. with broken line folding, are already repaired when they are loaded, see parseCalendar.
+// Parameters:
+// - 'action', default "fix": "fix" repairs the events, "drop" removes all events with problems
+// - 'default-duration', default "1h": duration of timed events without end
+// - 'report', default false: if "true", the problems are listed in X-ICAL-RELAY-REPAIRED of the repaired events.
+// Problems are logged as warnings in any case.
+// Returns the number of events removed. (always negative)
+func moduleRepair(cal *ics.Calendar, params map[string]string) (int, error) {
+	defaultDuration, err := parseRepairParams(params)
+	if err != nil {
+		return 0, err
+	}
+	loc, err := getParamLocation(params)
+	if err != nil {
+		return 0, err
+	}
+
+	var count int
+	for i := len(cal.Components) - 1; i >= 0; i-- { // iterate over events backwards
+		item := getItemBase(cal.Components[i])
+		if item == nil {
+			continue
+		}
+		id := getItemId(item)
+		var problems []string
+		var broken bool
+		switch component := cal.Components[i].(type) {
+		case *ics.VEvent:
+			problems, broken = repairEvent(component, loc, defaultDuration)
+		default:
+			problems = repairTodo(component, loc)
+		}
+		if len(problems) == 0 {
+			continue
+		}
+		itemType := getItemType(cal.Components[i])
+		if broken || params["action"] == "drop" {
+			cal.Components = removeFromICS(cal.Components, i)
+			count--
+			log.Warnf("Dropped %s '%s': %s", itemType, id, strings.Join(problems, ", "))
+			continue
+		}
+		log.Warnf("Repaired %s '%s': %s", itemType, getItemId(item), strings.Join(problems, ", "))
+		if params["report"] == "true" {
+			item.SetProperty("X-ICAL-RELAY-REPAIRED", ics.ToText(strings.Join(problems, "; ")))
+		}
+	}
+	return count, nil
+}
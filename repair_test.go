@@ -0,0 +1,153 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	ics "github.com/arran4/golang-ical"
+)
+
+func TestRepairICSText(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{
+			"unfolded description",
+			"BEGIN:VEVENT\nDESCRIPTION:Agenda\nNOTE: bring laptop\nand charger\nSUMMARY:Meeting\nEND:VEVENT",
+			"BEGIN:VEVENT\r\nDESCRIPTION:Agenda\\nNOTE: bring laptop\\nand charger\r\nSUMMARY:Meeting\r\nEND:VEVENT\r\n",
+		},
+		{
+			"lowercase and X- properties",
+			"BEGIN:VEVENT\nsummary:Meeting\nX-COURSE;LANG=de:INF-101\nEND:VEVENT",
+			"BEGIN:VEVENT\r\nsummary:Meeting\r\nX-COURSE;LANG=de:INF-101\r\nEND:VEVENT\r\n",
+		},
+		{
+			"folded lines are kept",
+			"BEGIN:VEVENT\nDESCRIPTION:first\n  second\n\tthird\nEND:VEVENT",
+			"BEGIN:VEVENT\r\nDESCRIPTION:first\r\n  second\r\n\tthird\r\nEND:VEVENT\r\n",
+		},
+		{
+			"missing END lines and empty lines",
+			"BEGIN:VCALENDAR\r\n\r\nBEGIN:VEVENT\r\nUID:1\r\n",
+			"BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:1\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n",
+		},
+		{
+			"text that looks like a parameter",
+			"BEGIN:VEVENT\nDESCRIPTION:Room\nHS3;B: ground floor\nEND:VEVENT",
+			"BEGIN:VEVENT\r\nDESCRIPTION:Room\\nHS3;B: ground floor\r\nEND:VEVENT\r\n",
+		},
+	}
+	for _, test := range tests {
+		if got := repairICSText(test.data); got != test.want {
+			t.Errorf("%s: repairICSText(%q) = %q, want %q", test.name, test.data, got, test.want)
+		}
+	}
+}
+
+func TestIsContentLine(t *testing.T) {
+	for line, want := range map[string]bool{
+		"DTSTART;TZID=Europe/Berlin:20240101T100000": true,
+		"SUMMARY:Meeting":                      true,
+		"summary:Meeting":                      true,
+		"REFRESH-INTERVAL;VALUE=DURATION:PT1H": true,
+		"X-WR-CALNAME:Uni":                     true,
+		"x-custom:1":                           true,
+		"NOTE: bring laptop":                   false,
+		"Agenda: first item":                   false,
+		"TODO;later":                           false,
+		"  SUMMARY:folded":                     false,
+		"":                                     false,
+	} {
+		if got := isContentLine(line); got != want {
+			t.Errorf("isContentLine(%q) = %v, want %v", line, got, want)
+		}
+	}
+}
+
+func TestParseCalendarRepairsUnfoldedLines(t *testing.T) {
+	// the line without colon makes the calendar unparseable, so it is repaired
+	data := "BEGIN:VCALENDAR\nVERSION:2.0\nPRODID:test\nBEGIN:VEVENT\nUID:1\nDTSTAMP:20240101T000000Z\nDTSTART:20240101T100000Z\nDESCRIPTION:Agenda\nNOTE: bring laptop\nand charger\nSUMMARY:Meeting\nEND:VEVENT\nEND:VCALENDAR\n"
+	cal, err := parseCalendar(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := cal.Events()[0]
+	if got := ics.FromText(getPropertyValue(&event.ComponentBase, ics.ComponentPropertyDescription)); got != "Agenda\nNOTE: bring laptop\nand charger" {
+		t.Errorf("description = %q", got)
+	}
+	if got := getPropertyValue(&event.ComponentBase, ics.ComponentPropertySummary); got != "Meeting" {
+		t.Errorf("summary = %q", got)
+	}
+}
+
+func TestModuleRepairTodos(t *testing.T) {
+	cal := testCalendar(t, `BEGIN:VTODO
+SUMMARY:No UID
+DTSTART:20240110T100000Z
+DUE:20240105T100000Z
+END:VTODO
+BEGIN:VTODO
+UID:todo-2
+DTSTAMP:20240101T000000Z
+DTSTART:invalid
+DUE:20240105T100000Z
+DURATION:PT1H
+END:VTODO
+BEGIN:VTODO
+UID:todo-3
+DTSTAMP:20240101T000000Z
+SUMMARY:Undated
+END:VTODO
+BEGIN:VJOURNAL
+UID:journal-1
+DTSTART:2024-01-05
+END:VJOURNAL`)
+
+	count, err := moduleRepair(cal, map[string]string{"timezone": "UTC", "report": "true"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 || len(cal.Components) != 4 {
+		t.Fatalf("moduleRepair removed %d items, %d left", -count, len(cal.Components))
+	}
+
+	first := getItemBase(cal.Components[0])
+	if id := getItemId(first); !strings.HasPrefix(id, "repaired-") {
+		t.Errorf("todo without UID got UID %q", id)
+	}
+	if first.GetProperty(ics.ComponentPropertyDtstamp) == nil {
+		t.Error("todo without DTSTAMP didn't get one")
+	}
+	if start, due := getPropertyValue(first, ics.ComponentPropertyDtStart), getPropertyValue(first, ics.ComponentProperty(ics.PropertyDue)); start != "20240105T100000Z" || due != "20240110T100000Z" {
+		t.Errorf("swapped todo has DTSTART %s and DUE %s", start, due)
+	}
+
+	second := getItemBase(cal.Components[1])
+	if second.GetProperty(ics.ComponentPropertyDtStart) != nil || second.GetProperty(ics.ComponentProperty(ics.PropertyDuration)) != nil {
+		t.Error("invalid DTSTART or DURATION of todo wasn't removed")
+	}
+	if report := getPropertyValue(second, "X-ICAL-RELAY-REPAIRED"); !strings.Contains(report, "invalid DTSTART") {
+		t.Errorf("report of todo = %q", report)
+	}
+
+	if third := getItemBase(cal.Components[2]); third.GetProperty("X-ICAL-RELAY-REPAIRED") != nil {
+		t.Error("valid undated todo was reported")
+	}
+
+	journal := getItemBase(cal.Components[3])
+	if journal.GetProperty(ics.ComponentPropertyDtStart) != nil || journal.GetProperty(ics.ComponentPropertyDtstamp) == nil {
+		t.Error("journal entry wasn't repaired")
+	}
+
+	// with action drop, all items with problems are removed
+	cal = testCalendar(t, "BEGIN:VTODO\nSUMMARY:No UID\nEND:VTODO\nBEGIN:VTODO\nUID:ok\nDTSTAMP:20240101T000000Z\nEND:VTODO")
+	count, err = moduleRepair(cal, map[string]string{"timezone": "UTC", "action": "drop"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != -1 || len(cal.Components) != 1 || getItemId(getItemBase(cal.Components[0])) != "ok" {
+		t.Errorf("moduleRepair with action drop returned %d, %d items left", count, len(cal.Components))
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	ics "github.com/arran4/golang-ical"
+	log "github.com/sirupsen/logrus"
+)
+
+// This module replaces text in event properties using a regex, keeping parts of the original with capture groups.
+// E.g. regex "^INF-101 V \((.*)\)$" and replacement "Intro to CS" turn "INF-101 V (Room A1)" into "Intro to CS",
+// while replacement "Intro to CS ($1)" keeps the room.
+// Parameters:
+// - 'regex', mandatory: regex to search for in the property values
+// - 'replacement', optional: replacement text, "$1" or "${name}" insert capture groups. Empty by default, which removes the matched text.
+// - 'property', default "SUMMARY": comma separated list of properties to rewrite, e.g. "SUMMARY,LOCATION" or "X-COURSE"
+// - match rules, 'combine', 'after', 'before', 'period', optional: only rewrite matching events, see parseEventMatcher
+// Properties that are empty after the replacement are removed. CATEGORIES are rewritten one by one.
+// Returns the number of events removed or added (always 0).
+func moduleRewrite(cal *ics.Calendar, params map[string]string) (int, error) {
+	if params["regex"] == "" {
+		return 0, fmt.Errorf("missing mandatory Parameter 'regex'")
+	}
+	re, err := regexp.Compile(params["regex"])
+	if err != nil {
+		return 0, fmt.Errorf("invalid regex: %s", err.Error())
+	}
+	properties := parsePropertyList(params["property"])
+	matcher, err := parseEventMatcher(params)
+	if err != nil {
+		return 0, err
+	}
+	replace := func(value string) string {
+		return re.ReplaceAllString(value, params["replacement"])
+	}
+
+	for _, component := range cal.Components {
+		switch component.(type) {
+		case *ics.VEvent, *ics.VTodo, *ics.VJournal:
+			item := getItemBase(component)
+			matched, err := matcher.matches(component)
+			if err != nil {
+				log.Warnf("Skipping event: %s", err.Error())
+				continue
+			}
+			if !matched {
+				continue
+			}
+			for _, property := range properties {
+				if rewriteProperty(item, property, replace) {
+					log.Debug("Rewrote " + property + " of event with id " + getItemId(item) + "\n")
+				}
+			}
+		}
+	}
+	return 0, nil
+}
+
+// properties with TEXT values, whose ",", ";" and "\" are escaped. Custom X- properties are TEXT, too, unless they set VALUE.
+var textProperties = []string{"SUMMARY", "DESCRIPTION", "LOCATION", "COMMENT", "CATEGORIES", "RESOURCES", "CONTACT"}
+
+// isTextProperty returns true, if the value of the property is escaped TEXT
+func isTextProperty(p *ics.IANAProperty) bool {
+	if value, ok := p.ICalParameters[string(ics.ParameterValue)]; ok && len(value) > 0 && !strings.EqualFold(value[0], string(ics.ValueDataTypeText)) {
+		return false
+	}
+	return contains(textProperties, strings.ToUpper(p.IANAToken)) || strings.HasPrefix(strings.ToUpper(p.IANAToken), "X-")
+}
+
+// rewriteProperty replaces the values of the property by the result of replace. TEXT values are unescaped before and
+// escaped after the replacement, others like URL, GEO or RRULE are replaced as they are. Parameters of the property are kept.
+// Empty values are removed. Returns true, if a value was changed.
+func rewriteProperty(component *ics.ComponentBase, property string, replace func(string) string) bool {
+	if property == string(ics.ComponentPropertyCategories) {
+		categories := getCategories(component)
+		var rewritten []string
+		for _, c := range categories {
+			if c = strings.TrimSpace(replace(c)); c != "" && !contains(rewritten, c) {
+				rewritten = append(rewritten, c)
+			}
+		}
+		if strings.Join(categories, ",") == strings.Join(rewritten, ",") {
+			return false
+		}
+		removePropertyByName(component, ics.ComponentPropertyCategories)
+		if len(rewritten) > 0 {
+			component.AddProperty(ics.ComponentPropertyCategories, strings.Join(rewritten, ","))
+		}
+		return true
+	}
+
+	changed := false
+	for i := len(component.Properties) - 1; i >= 0; i-- {
+		p := &component.Properties[i]
+		if p.IANAToken != property {
+			continue
+		}
+		text := isTextProperty(p)
+		value := p.Value
+		if text {
+			value = ics.FromText(value)
+		}
+		newValue := replace(value)
+		if newValue == value {
+			continue
+		}
+		changed = true
+		if newValue == "" {
+			component.Properties = append(component.Properties[:i], component.Properties[i+1:]...)
+		} else if text {
+			p.Value = ics.ToText(newValue)
+		} else {
+			p.Value = newValue
+		}
+	}
+	return changed
+}
+
+// parsePropertyList parses a comma separated list of property names, as used in the 'property' parameter.
+// The default is SUMMARY.
+func parsePropertyList(list string) []string {
+	var properties []string
+	for _, p := range strings.Split(list, ",") {
+		if p = strings.ToUpper(strings.TrimSpace(p)); p != "" {
+			properties = append(properties, p)
+		}
+	}
+	if len(properties) == 0 {
+		properties = []string{string(ics.ComponentPropertySummary)}
+	}
+	return properties
+}
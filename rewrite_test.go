@@ -0,0 +1,56 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	ics "github.com/arran4/golang-ical"
+)
+
+func TestModuleRewrite(t *testing.T) {
+	event := `BEGIN:VEVENT
+UID:event-1
+DTSTAMP:20240101T000000Z
+DTSTART:20240119T140000Z
+SUMMARY:INF-101 V (Raum A1\, Bau B)
+URL:https://example.com/course?id=101;lang=de&term=ws,ss
+GEO:48.7758;9.1829
+X-COURSE:INF-101\; Gruppe 2
+X-LINK;VALUE=URI:https://example.com/a,b
+END:VEVENT`
+	tests := []struct {
+		params   map[string]string
+		property string
+		want     string
+	}{
+		// TEXT values are unescaped before and escaped after the replacement
+		{map[string]string{"regex": `^INF-101 V \((.*)\)$`, "replacement": "Intro to CS ($1)"}, "SUMMARY", `Intro to CS (Raum A1\, Bau B)`},
+		{map[string]string{"regex": `; Gruppe`, "replacement": ", Gruppe", "property": "X-COURSE"}, "X-COURSE", `INF-101\, Gruppe 2`},
+		// other values are kept as they are
+		{map[string]string{"regex": `example\.com`, "replacement": "example.org", "property": "URL"}, "URL", "https://example.org/course?id=101;lang=de&term=ws,ss"},
+		{map[string]string{"regex": `^48\.7758`, "replacement": "48.7760", "property": "GEO"}, "GEO", "48.7760;9.1829"},
+		{map[string]string{"regex": `/a,b$`, "replacement": "/c,d", "property": "x-link"}, "X-LINK", "https://example.com/c,d"},
+	}
+	for _, test := range tests {
+		cal := testCalendar(t, event)
+		if _, err := moduleRewrite(cal, test.params); err != nil {
+			t.Errorf("moduleRewrite(%v): unexpected error: %v", test.params, err)
+			continue
+		}
+		if got := getPropertyValue(&cal.Events()[0].ComponentBase, ics.ComponentProperty(test.property)); got != test.want {
+			t.Errorf("moduleRewrite(%v) wrote %s:%s, want %s", test.params, test.property, got, test.want)
+		}
+		if serialized := cal.Serialize(); !strings.Contains(serialized, "GEO:") || strings.Contains(serialized, `\;9`) {
+			t.Errorf("moduleRewrite(%v) corrupted GEO:\n%s", test.params, serialized)
+		}
+	}
+
+	// properties that are empty after the replacement are removed
+	cal := testCalendar(t, event)
+	if _, err := moduleRewrite(cal, map[string]string{"regex": ".*", "property": "URL,GEO"}); err != nil {
+		t.Fatal(err)
+	}
+	if event := cal.Events()[0]; event.GetProperty(ics.ComponentPropertyUrl) != nil || event.GetProperty(ics.ComponentPropertyGeo) != nil {
+		t.Error("empty URL and GEO weren't removed")
+	}
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+
+	ics "github.com/arran4/golang-ical"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	htmlTagRegex       = regexp.MustCompile(`(?is)<(/?)([a-z][a-z0-9]*)([^>]*)>`)
+	htmlHrefRegex      = regexp.MustCompile(`(?is)href\s*=\s*("([^"]*)"|'([^']*)'|([^\s>]+))`)
+	htmlLineBreakRegex = regexp.MustCompile(`(?i)<(br|p|div|li|tr)\b`)
+	htmlCommentRegex   = regexp.MustCompile(`(?s)<!--.*?-->`)
+	htmlInvisibleRegex = regexp.MustCompile(`(?is)<(script|style|head|title)[^>]*>.*?</(script|style|head|title)\s*>`)
+	urlRegex           = regexp.MustCompile(`https?://[^\s<>"'()]+`)
+	blankLinesRegex    = regexp.MustCompile(`\n{3,}`)
+	spacesRegex        = regexp.MustCompile(`[ \t\x{00a0}]+`)
+)
+
+// query parameters added by newsletters and ad networks to track clicks
+var trackingParamRegex = regexp.MustCompile(`^(utm_.*|fbclid|gclid|dclid|msclkid|mc_cid|mc_eid|_hsenc|_hsmi|mkt_tok|igshid|yclid)$`)
+
+// these tags end a line in plain text, list items start their own line
+var htmlBlockTags = []string{"br", "p", "div", "tr", "h1", "h2", "h3", "h4", "h5", "h6", "ul", "ol", "table", "blockquote", "hr"}
+
+// htmlToText converts HTML to plain text. Links are kept as "text (url)", list items start with "- ".
+func htmlToText(s string) string {
+	s = htmlCommentRegex.ReplaceAllString(s, "")
+	s = htmlInvisibleRegex.ReplaceAllString(s, "")
+	if htmlLineBreakRegex.MatchString(s) {
+		// line breaks in HTML source are only whitespace, if the HTML has its own
+		s = strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ").Replace(s)
+	}
+
+	var b strings.Builder
+	var href string
+	var linkStart int
+	last := 0
+	for _, m := range htmlTagRegex.FindAllStringSubmatchIndex(s, -1) {
+		b.WriteString(s[last:m[0]])
+		last = m[1]
+		closing := s[m[2]:m[3]] == "/"
+		tag := strings.ToLower(s[m[4]:m[5]])
+		attributes := s[m[6]:m[7]]
+		switch {
+		case tag == "a" && !closing:
+			href = ""
+			if h := htmlHrefRegex.FindStringSubmatch(attributes); h != nil {
+				href = html.UnescapeString(h[2] + h[3] + h[4])
+			}
+			linkStart = b.Len()
+		case tag == "a" && closing:
+			text := b.String()[linkStart:]
+			if href != "" && !strings.HasPrefix(href, "#") && strings.TrimPrefix(href, "mailto:") != strings.TrimSpace(html.UnescapeString(text)) {
+				b.WriteString(" (" + html.EscapeString(href) + ")")
+			}
+			href = ""
+		case tag == "li" && !closing:
+			b.WriteString("\n- ")
+		case contains(htmlBlockTags, tag):
+			b.WriteString("\n")
+		}
+	}
+	b.WriteString(s[last:])
+	return html.UnescapeString(b.String())
+}
+
+// looksLikeHTML returns true, if the text contains HTML tags or entities
+func looksLikeHTML(s string) bool {
+	return htmlTagRegex.MatchString(s) || strings.Contains(s, "&amp;") || strings.Contains(s, "&nbsp;") || strings.Contains(s, "&lt;")
+}
+
+// removeTrackingParams removes click tracking parameters like utm_source from all URLs in the text
+func removeTrackingParams(s string) string {
+	return urlRegex.ReplaceAllStringFunc(s, func(link string) string {
+		u, err := url.Parse(link)
+		if err != nil || u.RawQuery == "" {
+			return link
+		}
+		query := u.Query()
+		changed := false
+		for key := range query {
+			if trackingParamRegex.MatchString(strings.ToLower(key)) {
+				query.Del(key)
+				changed = true
+			}
+		}
+		if !changed {
+			return link
+		}
+		u.RawQuery = query.Encode()
+		return u.String()
+	})
+}
+
+// collapseWhitespace trims all lines, collapses spaces and allows at most one empty line in a row
+func collapseWhitespace(s string) string {
+	lines := strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(spacesRegex.ReplaceAllString(line, " "))
+	}
+	s = strings.Join(lines, "\n")
+	return strings.TrimSpace(blankLinesRegex.ReplaceAllString(s, "\n\n"))
+}
+
+// textToHTML converts plain text to simple HTML with clickable links
+func textToHTML(s string) string {
+	var b strings.Builder
+	b.WriteString("<html><body>")
+	last := 0
+	for _, m := range urlRegex.FindAllStringIndex(s, -1) {
+		b.WriteString(html.EscapeString(s[last:m[0]]))
+		link := html.EscapeString(s[m[0]:m[1]])
+		b.WriteString(`<a href="` + link + `">` + link + `</a>`)
+		last = m[1]
+	}
+	b.WriteString(html.EscapeString(s[last:]))
+	b.WriteString("</body></html>")
+	return strings.ReplaceAll(b.String(), "\n", "<br>")
+}
+
+// parseSanitizeParams checks the parameters of the sanitize module and compiles the boilerplate regex
+func parseSanitizeParams(params map[string]string) (*regexp.Regexp, error) {
+	var boilerplate *regexp.Regexp
+	if params["remove-regex"] != "" {
+		var err error
+		boilerplate, err = regexp.Compile(params["remove-regex"])
+		if err != nil {
+			return nil, fmt.Errorf("invalid regex in 'remove-regex': %s", err.Error())
+		}
+	}
+	for _, p := range []string{"remove-tracking", "collapse-whitespace"} {
+		if params[p] != "" && params[p] != "true" && params[p] != "false" {
+			return nil, fmt.Errorf("invalid value for '%s': %s", p, params[p])
+		}
+	}
+	switch params["alt-desc"] {
+	case "", "remove", "keep", "generate":
+	default:
+		return nil, fmt.Errorf("invalid value for 'alt-desc', must be 'remove', 'keep' or 'generate'")
+	}
+	return boilerplate, nil
+}
+
+// This module cleans up descriptions of events, todos and journal entries: HTML is converted to plain text, tracking parameters and boilerplate are removed
+// and whitespace is collapsed. Descriptions that only contain HTML in X-ALT-DESC get it as plain text.
+// Parameters:
+// - 'property', default "DESCRIPTION": comma separated list of properties to clean
+// - 'remove-regex', optional: regex of boilerplate text to remove, e.g. "(?s)Diese Nachricht wurde .*$"
+// - 'remove-tracking', default true: remove click tracking parameters like utm_source from links
+// - 'collapse-whitespace', default true: trim lines, collapse spaces and empty lines
+// - 'alt-desc', default "remove": "remove" removes X-ALT-DESC, "keep" leaves it unchanged, "generate" writes a clean
+// X-ALT-DESC;FMTTYPE=text/html from the description, with clickable links
+// - match rules, 'combine', 'after', 'before', 'period', optional: only clean matching items, see parseEventMatcher
+// Returns the number of events removed or added (always 0).
+func moduleSanitize(cal *ics.Calendar, params map[string]string) (int, error) {
+	boilerplate, err := parseSanitizeParams(params)
+	if err != nil {
+		return 0, err
+	}
+	if params["property"] == "" {
+		params["property"] = string(ics.ComponentPropertyDescription)
+	}
+	properties := parsePropertyList(params["property"])
+	matcher, err := parseEventMatcher(params)
+	if err != nil {
+		return 0, err
+	}
+
+	clean := func(value string) string {
+		// values escaped twice by the upstream system still contain "\n" or "\,"
+		if strings.Contains(value, `\n`) || strings.Contains(value, `\,`) || strings.Contains(value, `\;`) {
+			value = ics.FromText(value)
+		}
+		// entities escaped twice, e.g. "&amp;nbsp;"
+		for i := 0; i < 2 && looksLikeHTML(value); i++ {
+			if htmlTagRegex.MatchString(value) {
+				value = htmlToText(value)
+			} else {
+				value = html.UnescapeString(value)
+			}
+		}
+		if boilerplate != nil {
+			value = boilerplate.ReplaceAllString(value, "")
+		}
+		if params["remove-tracking"] != "false" {
+			value = removeTrackingParams(value)
+		}
+		if params["collapse-whitespace"] != "false" {
+			value = collapseWhitespace(value)
+		}
+		return value
+	}
+
+	for _, component := range cal.Components {
+		item := getItemBase(component)
+		if item == nil {
+			continue
+		}
+		matched, err := matcher.matches(component)
+		if err != nil {
+			log.Warnf("Skipping event: %s", err.Error())
+			continue
+		}
+		if !matched {
+			continue
+		}
+		altDesc := ics.FromText(getPropertyValue(item, "X-ALT-DESC"))
+		if strings.TrimSpace(getPropertyValue(item, ics.ComponentPropertyDescription)) == "" && altDesc != "" {
+			// some systems only send the HTML version
+			item.SetProperty(ics.ComponentPropertyDescription, ics.ToText(altDesc))
+		}
+		for _, property := range properties {
+			if rewriteProperty(item, property, clean) {
+				log.Debug("Sanitized " + property + " of " + getItemType(component) + " with id " + getItemId(item) + "\n")
+			}
+		}
+		switch params["alt-desc"] {
+		case "", "remove":
+			removePropertyByName(item, "X-ALT-DESC")
+		case "generate":
+			description := ics.FromText(getPropertyValue(item, ics.ComponentPropertyDescription))
+			if description == "" {
+				removePropertyByName(item, "X-ALT-DESC")
+			} else {
+				item.SetProperty("X-ALT-DESC", ics.ToText(textToHTML(description)), ics.WithFmtType("text/html"))
+			}
+		}
+	}
+	return 0, nil
+}
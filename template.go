@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	ics "github.com/arran4/golang-ical"
+	log "github.com/sirupsen/logrus"
+)
+
+// templateEvent is the data the templates of the template module are executed on.
+// Start and End of todos and journal entries without dates are the zero time.
+type templateEvent struct {
+	Type        string // "event", "todo" or "journal"
+	Summary     string
+	Description string
+	Location    string
+	UID         string
+	Status      string
+	URL         string
+	Categories  []string
+	Start       time.Time
+	End         time.Time
+	Duration    time.Duration
+	AllDay      bool
+	item        *ics.ComponentBase
+}
+
+// getTemplateFuncs returns the helper functions available in templates. Times are formatted in loc.
+func getTemplateFuncs(loc *time.Location, table []lookupEntry) template.FuncMap {
+	return template.FuncMap{
+		// date formats a time with a Go layout, e.g. {{date "02.01.2006 15:04" .Start}}
+		"date": func(layout string, t time.Time) string {
+			return t.In(loc).Format(layout)
+		},
+		// extract returns the first capture group of the regex, or the whole match without groups, e.g. {{extract "Dozent: (.*)" .Description}}
+		"extract": func(expr string, s string) (string, error) {
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return "", err
+			}
+			m := re.FindStringSubmatch(s)
+			switch {
+			case m == nil:
+				return "", nil
+			case len(m) > 1:
+				return m[1], nil
+			}
+			return m[0], nil
+		},
+		// replace replaces all matches of the regex, e.g. {{replace "^INF-(\\d+)" "Informatik $1" .Summary}}
+		"replace": func(expr string, replacement string, s string) (string, error) {
+			re, err := regexp.Compile(expr)
+			if err != nil {
+				return "", err
+			}
+			return re.ReplaceAllString(s, replacement), nil
+		},
+		// lookup maps a key with the table of the module, keys without entry are returned unchanged
+		"lookup": func(key string) string {
+			return lookup(table, "exact", key)
+		},
+		"lower": strings.ToLower,
+		"upper": strings.ToUpper,
+		"trim":  strings.TrimSpace,
+		"join":  func(sep string, list []string) string { return strings.Join(list, sep) },
+		"default": func(def string, s string) string {
+			if strings.TrimSpace(s) == "" {
+				return def
+			}
+			return s
+		},
+	}
+}
+
+// parseTemplateParams parses the templates of the 'set-<PROPERTY>' parameters and the lookup table
+func parseTemplateParams(params map[string]string, loc *time.Location) (map[string]*template.Template, []lookupEntry, error) {
+	var table []lookupEntry
+	var err error
+	if params["file"] != "" || params["upload"] != "" || params["table"] != "" {
+		table, err = loadLookupTable(params)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	templates := make(map[string]*template.Template)
+	for k, v := range params {
+		if !strings.HasPrefix(k, "set-") || len(k) == len("set-") {
+			continue
+		}
+		property := strings.ToUpper(strings.TrimPrefix(k, "set-"))
+		templates[property], err = template.New(property).Funcs(getTemplateFuncs(loc, table)).Option("missingkey=error").Parse(v)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid template in '%s': %s", k, err.Error())
+		}
+	}
+	if len(templates) == 0 {
+		return nil, nil, fmt.Errorf("missing templates, e.g. 'set-DESCRIPTION'")
+	}
+	return templates, table, nil
+}
+
+// Prop returns the unescaped value of any property, e.g. {{.Prop "X-COURSE"}}. It is empty, if the property isn't set.
+func (e templateEvent) Prop(name string) string {
+	return ics.FromText(getPropertyValue(e.item, ics.ComponentProperty(strings.ToUpper(name))))
+}
+
+// This module sets properties of events, todos and journal entries from Go templates (https://pkg.go.dev/text/template) over the item.
+// E.g. 'set-DESCRIPTION: "{{.Description}}\n\nRaum: {{.Location}} {{lookup .Location}}"'
+// The templates get the fields Type, Summary, Description, Location, UID, Status, URL, Categories, Start, End, Duration and AllDay,
+// all other properties are available with {{.Prop "X-NAME"}}. All templates see the values before the edit.
+// Helper functions are date, extract, replace, lookup, lower, upper, trim, join and default, see getTemplateFuncs.
+// Parameters:
+// - 'set-<PROPERTY>', at least one: template whose result is written to the property. Empty results remove the property.
+// - 'table', 'upload' or 'file', optional: lookup table for the lookup function, see moduleMap. 'file' is not allowed for low-privilege users.
+// - 'format', optional: format of the lookup table, see moduleMap
+// - match rules, 'combine', 'after', 'before', 'period', optional: only edit matching events, see parseEventMatcher
+// Returns the number of events removed or added (always 0).
+func moduleTemplate(cal *ics.Calendar, params map[string]string) (int, error) {
+	loc, err := getParamLocation(params)
+	if err != nil {
+		return 0, err
+	}
+	templates, _, err := parseTemplateParams(params, loc)
+	if err != nil {
+		return 0, err
+	}
+	matcher, err := parseEventMatcher(params)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, component := range cal.Components {
+		item := getItemBase(component)
+		if item == nil {
+			continue
+		}
+		matched, err := matcher.matches(component)
+		if err != nil {
+			log.Warnf("Skipping event: %s", err.Error())
+			continue
+		}
+		if !matched {
+			continue
+		}
+		start, end, allDay, err := getItemTimes(component, loc)
+		if err != nil && err != errUndated {
+			log.Warnf("Skipping event: %s", err.Error())
+			continue
+		}
+		data := templateEvent{
+			Type:        getItemType(component),
+			Summary:     ics.FromText(getPropertyValue(item, ics.ComponentPropertySummary)),
+			Description: ics.FromText(getPropertyValue(item, ics.ComponentPropertyDescription)),
+			Location:    ics.FromText(getPropertyValue(item, ics.ComponentPropertyLocation)),
+			UID:         getItemId(item),
+			Status:      getPropertyValue(item, ics.ComponentPropertyStatus),
+			URL:         getPropertyValue(item, ics.ComponentPropertyUrl),
+			Categories:  getCategories(item),
+			Start:       start.In(loc),
+			End:         end.In(loc),
+			Duration:    end.Sub(start),
+			AllDay:      allDay,
+			item:        item,
+		}
+		// render all templates before changing the event, so they all see the original values
+		values := make(map[string]string)
+		for property, t := range templates {
+			var b strings.Builder
+			err = t.Execute(&b, data)
+			if err != nil {
+				break
+			}
+			values[property] = b.String()
+		}
+		if err != nil {
+			log.Warnf("Skipping event %s: %s", data.UID, err.Error())
+			continue
+		}
+		for property, value := range values {
+			if strings.TrimSpace(value) == "" {
+				removePropertyByName(item, ics.ComponentProperty(property))
+			} else {
+				item.SetProperty(ics.ComponentProperty(property), ics.ToText(value))
+			}
+		}
+		log.Debug("Rendered templates for " + data.Type + " with id " + data.UID + "\n")
+	}
+	return 0, nil
+}
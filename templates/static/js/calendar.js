@@ -18,10 +18,57 @@ function getEventCard(event, show_edit = false, edit_enabled = true) {
     let event_title = document.createElement("h6");
     event_title.classList.add("card-title");
     event_title.innerText = event.title;
+    if (event.cancelled) {
+        event_title.classList.add("text-decoration-line-through");
+        event_title.title = "Abgesagt";
+        event_card.classList.add("text-muted");
+    }
+    if (event.type) {
+        // todos and journal entries are marked with a badge
+        let type_badge = document.createElement("span");
+        type_badge.classList.add("badge", "text-bg-light", "border", "fw-normal", "me-1");
+        if (event.type === "todo") {
+            type_badge.innerText = event.completed ? "✓ Erledigt" : "Aufgabe";
+        } else {
+            type_badge.innerText = "Journal";
+        }
+        if (event.completed) {
+            event_card.classList.add("text-muted");
+        }
+        event_title.prepend(type_badge);
+    }
     event_body.appendChild(event_title);
+    if (event.color) {
+        // COLOR is a CSS color name (RFC 7986)
+        event_card.style.borderLeft = "5px solid " + event.color;
+    }
+    if (event.categories) {
+        let badges = document.createElement("div");
+        badges.classList.add("mb-1");
+        for (let category of event.categories) {
+            let badge = document.createElement("span");
+            badge.classList.add("badge", "rounded-pill", "text-bg-secondary", "me-1");
+            if (event.color) {
+                badge.classList.remove("text-bg-secondary");
+                badge.style.backgroundColor = event.color;
+            }
+            badge.innerText = category;
+            badges.appendChild(badge);
+        }
+        event_body.appendChild(badges);
+    }
     let event_text = document.createElement("div");
     event_text.classList.add("card-text");
-    event_text.innerText = dayjs(event.start).format("HH:mm") + " - " + dayjs(event.end).format("HH:mm");
+    if (event.type === "todo") {
+        event_text.innerText = event.allday ? "Fällig" : "Fällig um " + event.end_time;
+    } else if (event.allday) {
+        event_text.innerText = "Ganztägig";
+    } else if (event.type === "journal") {
+        event_text.innerText = event.start_time;
+    } else {
+        // times are formatted in the timezone of the profile
+        event_text.innerText = event.start_time + " - " + event.end_time;
+    }
     if (event.location) {
         event_text.appendChild(document.createElement("br"));
         event_text.appendChild(locationToNode(event.location));
@@ -51,7 +98,8 @@ function getEventCard(event, show_edit = false, edit_enabled = true) {
         event_text.appendChild(description_el);
     }
     event_body.appendChild(event_text);
-    if (show_edit) {
+    // events without UID can't be edited
+    if (show_edit && event.edit_url) {
         let edit_button = document.createElement("button");
         edit_button.classList.add("btn", "btn-sm", "btn-outline-secondary", "rounded-circle", "edit-button");
         if(!edit_enabled){
@@ -67,7 +115,21 @@ function getEventCard(event, show_edit = false, edit_enabled = true) {
     return event_card;
 }
 
-function getDayVStack(date, events, show_edit = false, edit_enabled = true) {
+// returns all categories of the events, sorted by name
+function getCategories(events) {
+    let categories = new Set();
+    for (let day in events) {
+        for (let event of events[day]) {
+            for (let category of event.categories || []) {
+                categories.add(category);
+            }
+        }
+    }
+    return Array.from(categories).sort();
+}
+
+// category_filter hides all events without this category, if it isn't empty
+function getDayVStack(date, events, show_edit = false, edit_enabled = true, category_filter = "") {
     let day_vstack = document.createElement("div");
     document.createElement("div");
     day_vstack.classList.add("vstack", "col-md-4", "col-xl-2", "pt-2", "day-column", "mb-3");
@@ -80,9 +142,15 @@ function getDayVStack(date, events, show_edit = false, edit_enabled = true) {
     day_vstack.appendChild(day_title);
 
     let currentMonth = location.hash ? dayjs(location.hash.substring(1)).format("MM") : dayjs().startOf("month").format("MM");
-    if (events[date.format("YYYY-MM-DD")] != undefined) {
-        let day_events = events[date.format("YYYY-MM-DD")];
+    let day_events = (events[date.format("YYYY-MM-DD")] || []).filter(function (event) {
+        return category_filter == "" || (event.categories || []).includes(category_filter);
+    });
+    if (day_events.length > 0) {
         day_events.sort(function (a, b) {
+            // all-day events first, they may have started on an earlier day
+            if (a.allday != b.allday) {
+                return a.allday ? -1 : 1;
+            }
             return dayjs(a.start).diff(dayjs(b.start));
         });
         for (let event of day_events) {
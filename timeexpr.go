@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// matches one offset at the end of a time expression, e.g. "+2w" or "-30d"
+var timeOffsetRegex = regexp.MustCompile(`([+-])(\d+)([smhdwMy])$`)
+
+var weekdays = map[string]time.Weekday{
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+	"sunday":    time.Sunday,
+}
+
+// parseTimeExpression parses a time given in a module parameter.
+// An expression is an anchor followed by any number of offsets.
+//
+// Anchors:
+//   - "now": the current time
+//   - "today" or "startOfDay": midnight of the current day
+//   - "startOfWeek": midnight of the monday of the current week
+//   - "startOfMonth", "startOfYear": midnight of the first day of the current month or year
+//   - "monday" to "sunday": midnight of this weekday in the current week (weeks start on monday)
+//   - "nextMonday" to "nextSunday", "lastMonday" to "lastSunday": the next or last occurrence of the weekday, not counting today
+//   - absolute times in RFC3339 format, RFC3339 without offset ("2006-01-02T15:04:05") or a date ("2006-01-02")
+//
+// Offsets are a sign, a number and one of the units s, m (minutes), h, d, w, M (months) and y, e.g. "now-30d" or "startOfMonth+1M".
+// Times without offset and all relative anchors are evaluated in loc. Anchor names are case-insensitive.
+func parseTimeExpression(expr string, loc *time.Location) (time.Time, error) {
+	return parseTimeExpressionAt(expr, time.Now(), loc)
+}
+
+// parseTimeExpressionAt parses a time expression like parseTimeExpression, with relative anchors based on now
+func parseTimeExpressionAt(expr string, now time.Time, loc *time.Location) (time.Time, error) {
+	expr = strings.TrimSpace(expr)
+	if expr == "" {
+		return time.Time{}, fmt.Errorf("empty time expression")
+	}
+
+	// split offsets from the end of the expression
+	var offsets [][]string
+	anchor := expr
+	for {
+		m := timeOffsetRegex.FindStringSubmatch(anchor)
+		if m == nil {
+			break
+		}
+		offsets = append([][]string{m}, offsets...)
+		anchor = strings.TrimSuffix(anchor, m[0])
+	}
+
+	t, err := parseTimeAnchor(anchor, now, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time expression '%s': %s", expr, err.Error())
+	}
+
+	for _, m := range offsets {
+		n, err := strconv.Atoi(m[2])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid offset '%s' in time expression '%s'", m[0], expr)
+		}
+		if m[1] == "-" {
+			n = -n
+		}
+		switch m[3] {
+		case "s":
+			t = t.Add(time.Duration(n) * time.Second)
+		case "m":
+			t = t.Add(time.Duration(n) * time.Minute)
+		case "h":
+			t = t.Add(time.Duration(n) * time.Hour)
+		case "d":
+			t = t.AddDate(0, 0, n)
+		case "w":
+			t = t.AddDate(0, 0, 7*n)
+		case "M":
+			t = t.AddDate(0, n, 0)
+		case "y":
+			t = t.AddDate(n, 0, 0)
+		}
+	}
+	return t, nil
+}
+
+// parseTimeAnchor parses the anchor of a time expression, see parseTimeExpression
+func parseTimeAnchor(anchor string, now time.Time, loc *time.Location) (time.Time, error) {
+	now = now.In(loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	// days since monday
+	weekday := (int(today.Weekday()) + 6) % 7
+
+	name := strings.ToLower(anchor)
+	switch name {
+	case "now":
+		return now, nil
+	case "today", "startofday":
+		return today, nil
+	case "startofweek":
+		return today.AddDate(0, 0, -weekday), nil
+	case "startofmonth":
+		return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc), nil
+	case "startofyear":
+		return time.Date(now.Year(), time.January, 1, 0, 0, 0, 0, loc), nil
+	}
+	if day, ok := weekdays[name]; ok {
+		return today.AddDate(0, 0, (int(day)+6)%7-weekday), nil
+	}
+	if day, ok := weekdays[strings.TrimPrefix(name, "next")]; ok && strings.HasPrefix(name, "next") {
+		diff := (int(day) - int(today.Weekday()) + 7) % 7
+		if diff == 0 {
+			diff = 7
+		}
+		return today.AddDate(0, 0, diff), nil
+	}
+	if day, ok := weekdays[strings.TrimPrefix(name, "last")]; ok && strings.HasPrefix(name, "last") {
+		diff := (int(today.Weekday()) - int(day) + 7) % 7
+		if diff == 0 {
+			diff = 7
+		}
+		return today.AddDate(0, 0, -diff), nil
+	}
+
+	// absolute times
+	if t, err := time.ParseInLocation("2006-01-02", anchor, loc); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02T15:04:05", anchor, loc); err == nil {
+		return t, nil
+	}
+	t, err := time.Parse(time.RFC3339, anchor)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("unknown anchor '%s'", anchor)
+	}
+	return t, nil
+}
+
+// parseTimeframe parses the two parameters limiting the timeframe of a module, e.g. 'after' and 'before'.
+// If the parameter 'period' names a period from the config, it is used as timeframe. The two parameters still override it.
+// Missing parameters are replaced by the zero time or maxTime, so the timeframe is open on this side.
+func parseTimeframe(params map[string]string, startParam string, endParam string, loc *time.Location) (time.Time, time.Time, error) {
+	start := time.Time{}
+	end := maxTime
+	var err error
+	if params["period"] != "" {
+		start, end, err = getPeriodTimeframe(params["period"], loc)
+		if err != nil {
+			return start, end, err
+		}
+		// timeframes exclude their start, but events starting with the period are part of it
+		start = start.Add(-time.Nanosecond)
+	}
+	if params[startParam] != "" {
+		start, err = parseTimeExpression(params[startParam], loc)
+		if err != nil {
+			return start, end, fmt.Errorf("invalid start time: %s", err.Error())
+		}
+	}
+	if params[endParam] != "" {
+		end, err = parseTimeExpression(params[endParam], loc)
+		if err != nil {
+			return start, end, fmt.Errorf("invalid end time: %s", err.Error())
+		}
+	}
+	return start, end, nil
+}
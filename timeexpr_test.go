@@ -0,0 +1,120 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimeExpression(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a wednesday
+	now := time.Date(2024, time.January, 17, 15, 30, 0, 0, loc)
+	date := func(year int, month time.Month, day int, hour int, min int) time.Time {
+		return time.Date(year, month, day, hour, min, 0, 0, loc)
+	}
+
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"now", now},
+		{"  now+90m ", date(2024, time.January, 17, 17, 0)},
+		{"now-30d", date(2023, time.December, 18, 15, 30)},
+		{"now+1y", date(2025, time.January, 17, 15, 30)},
+		{"now-10s", now.Add(-10 * time.Second)},
+		{"today", date(2024, time.January, 17, 0, 0)},
+		{"TODAY", date(2024, time.January, 17, 0, 0)},
+		{"startOfDay+8h", date(2024, time.January, 17, 8, 0)},
+		{"startOfWeek", date(2024, time.January, 15, 0, 0)},
+		{"startOfMonth+1M", date(2024, time.February, 1, 0, 0)},
+		{"startOfYear", date(2024, time.January, 1, 0, 0)},
+		{"today+1w-1d", date(2024, time.January, 23, 0, 0)},
+		{"monday", date(2024, time.January, 15, 0, 0)},
+		{"wednesday", date(2024, time.January, 17, 0, 0)},
+		{"sunday", date(2024, time.January, 21, 0, 0)},
+		{"nextFriday", date(2024, time.January, 19, 0, 0)},
+		{"nextWednesday", date(2024, time.January, 24, 0, 0)},
+		{"lastMonday", date(2024, time.January, 15, 0, 0)},
+		{"lastWednesday", date(2024, time.January, 10, 0, 0)},
+		{"lastThursday+12h", date(2024, time.January, 11, 12, 0)},
+		{"2024-03-01", date(2024, time.March, 1, 0, 0)},
+		{"2024-03-01T10:00:00", date(2024, time.March, 1, 10, 0)},
+		{"2024-03-01T10:00:00Z", time.Date(2024, time.March, 1, 10, 0, 0, 0, time.UTC)},
+		{"2024-03-01T10:00:00+02:00-1h", time.Date(2024, time.March, 1, 7, 0, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		got, err := parseTimeExpressionAt(test.expr, now, loc)
+		if err != nil {
+			t.Errorf("parseTimeExpressionAt(%q): unexpected error: %v", test.expr, err)
+			continue
+		}
+		if !got.Equal(test.want) {
+			t.Errorf("parseTimeExpressionAt(%q) = %v, want %v", test.expr, got, test.want)
+		}
+	}
+
+	for _, expr := range []string{"", "   ", "tomorrow", "now+2x", "+1d", "now+", "now 1d", "nextday", "2024-13-01"} {
+		if _, err := parseTimeExpressionAt(expr, now, loc); err == nil {
+			t.Errorf("parseTimeExpressionAt(%q): expected an error", expr)
+		}
+	}
+}
+
+func TestParseTimeframe(t *testing.T) {
+	loc := time.UTC
+	oldPeriods := conf.Periods
+	defer func() { conf.Periods = oldPeriods }()
+	conf.Periods = map[string]period{
+		"semester": {From: "2024-04-01", Until: "2024-07-31"},
+		"week":     {From: "2024-04-01T08:00:00Z", Until: "2024-04-05T18:00:00Z"},
+	}
+
+	tests := []struct {
+		params    map[string]string
+		wantStart time.Time
+		wantEnd   time.Time
+	}{
+		{map[string]string{}, time.Time{}, maxTime},
+		{map[string]string{"after": "2024-01-01"}, time.Date(2024, time.January, 1, 0, 0, 0, 0, loc), maxTime},
+		{map[string]string{"before": "2024-01-01"}, time.Time{}, time.Date(2024, time.January, 1, 0, 0, 0, 0, loc)},
+		// periods exclude their start, so it is shifted by one nanosecond. Date ends include the whole day.
+		{map[string]string{"period": "semester"}, time.Date(2024, time.April, 1, 0, 0, 0, 0, loc).Add(-time.Nanosecond), time.Date(2024, time.August, 1, 0, 0, 0, 0, loc)},
+		{map[string]string{"period": "week"}, time.Date(2024, time.April, 1, 8, 0, 0, 0, loc).Add(-time.Nanosecond), time.Date(2024, time.April, 5, 18, 0, 0, 0, loc)},
+		// explicit parameters override the period
+		{map[string]string{"period": "semester", "before": "2024-05-01"}, time.Date(2024, time.April, 1, 0, 0, 0, 0, loc).Add(-time.Nanosecond), time.Date(2024, time.May, 1, 0, 0, 0, 0, loc)},
+		{map[string]string{"period": "semester", "after": "2024-05-01"}, time.Date(2024, time.May, 1, 0, 0, 0, 0, loc), time.Date(2024, time.August, 1, 0, 0, 0, 0, loc)},
+	}
+	for _, test := range tests {
+		start, end, err := parseTimeframe(test.params, "after", "before", loc)
+		if err != nil {
+			t.Errorf("parseTimeframe(%v): unexpected error: %v", test.params, err)
+			continue
+		}
+		if !start.Equal(test.wantStart) || !end.Equal(test.wantEnd) {
+			t.Errorf("parseTimeframe(%v) = %v, %v, want %v, %v", test.params, start, end, test.wantStart, test.wantEnd)
+		}
+	}
+
+	// an event starting with the period is part of it
+	start, end, err := parseTimeframe(map[string]string{"period": "semester"}, "after", "before", loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	periodStart := time.Date(2024, time.April, 1, 0, 0, 0, 0, loc)
+	if !(periodStart.After(start) && periodStart.Before(end)) {
+		t.Errorf("start of period %v is not in timeframe %v - %v", periodStart, start, end)
+	}
+
+	for _, params := range []map[string]string{
+		{"period": "unknown"},
+		{"after": "someday"},
+		{"before": "now+1q"},
+	} {
+		if _, _, err := parseTimeframe(params, "after", "before", loc); err == nil {
+			t.Errorf("parseTimeframe(%v): expected an error", params)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+
+	ics "github.com/arran4/golang-ical"
+	log "github.com/sirupsen/logrus"
+)
+
+// time formats used in iCalendar DATE and DATE-TIME values
+const (
+	icalDateTimeFormatUTC   = "20060102T150405Z"
+	icalDateTimeFormatLocal = "20060102T150405"
+	icalDateFormat          = "20060102"
+)
+
+// this is the maximum time that can be represented in the time.Time struct
+var maxTime = time.Unix(1<<63-1-int64((1969*365+1969/4-1969/100+1969/400)*24*60*60), 999999999)
+
+var icalDurationRegex = regexp.MustCompile(`^([+-])?P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// parseICalTime parses a DATE or DATE-TIME property value.
+// UTC values ("...Z") and values with a TZID parameter are absolute, floating values and dates are read in loc.
+// The second return value is true, if the value is a DATE (all-day) value.
+func parseICalTime(prop *ics.IANAProperty, loc *time.Location) (time.Time, bool, error) {
+	if prop == nil {
+		return time.Time{}, false, fmt.Errorf("property not found")
+	}
+	value := prop.Value
+	if tzid, ok := prop.ICalParameters["TZID"]; ok && len(tzid) > 0 {
+		tz, err := time.LoadLocation(tzid[0])
+		if err != nil {
+			return time.Time{}, false, fmt.Errorf("unknown TZID '%s': %s", tzid[0], err.Error())
+		}
+		loc = tz
+	}
+	switch {
+	case len(value) == len(icalDateTimeFormatUTC) && value[len(value)-1] == 'Z':
+		t, err := time.ParseInLocation(icalDateTimeFormatUTC, value, time.UTC)
+		return t, false, err
+	case len(value) == len(icalDateTimeFormatLocal):
+		t, err := time.ParseInLocation(icalDateTimeFormatLocal, value, loc)
+		return t, false, err
+	case len(value) == len(icalDateFormat):
+		t, err := time.ParseInLocation(icalDateFormat, value, loc)
+		return t, true, err
+	case len(value) == len(icalDateFormat)+1 && value[len(value)-1] == 'Z':
+		// not valid RFC 5545, but written by golang-ical's SetAllDayStartAt
+		t, err := time.ParseInLocation(icalDateFormat, value[:len(value)-1], loc)
+		return t, true, err
+	}
+	return time.Time{}, false, fmt.Errorf("unsupported time value '%s'", value)
+}
+
+// parseICalDuration parses a RFC 5545 DURATION value, e.g. "PT1H30M" or "-P1D".
+func parseICalDuration(value string) (time.Duration, error) {
+	m := icalDurationRegex.FindStringSubmatch(value)
+	if m == nil || value == "P" || value == "PT" {
+		return 0, fmt.Errorf("invalid duration '%s'", value)
+	}
+	units := []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second}
+	var d time.Duration
+	for i, unit := range units {
+		if m[i+2] == "" {
+			continue
+		}
+		n, err := strconv.Atoi(m[i+2])
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration '%s': %s", value, err.Error())
+		}
+		d += time.Duration(n) * unit
+	}
+	if m[1] == "-" {
+		d = -d
+	}
+	return d, nil
+}
+
+// formatICalDuration formats a duration as RFC 5545 DURATION value, e.g. "-PT1H30M". Fractions of seconds are dropped.
+func formatICalDuration(d time.Duration) string {
+	sign := ""
+	if d < 0 {
+		sign = "-"
+		d = -d
+	}
+	days := d / (24 * time.Hour)
+	d -= days * 24 * time.Hour
+	value := sign + "P"
+	if days > 0 {
+		value += strconv.Itoa(int(days)) + "D"
+	}
+	if d >= time.Second || days == 0 {
+		value += "T"
+		if h := d / time.Hour; h > 0 {
+			value += strconv.Itoa(int(h)) + "H"
+		}
+		if m := d % time.Hour / time.Minute; m > 0 {
+			value += strconv.Itoa(int(m)) + "M"
+		}
+		if sec := d % time.Minute / time.Second; sec > 0 || d < time.Second {
+			value += strconv.Itoa(int(sec)) + "S"
+		}
+	}
+	return value
+}
+
+// getEventTimes returns the start and end of an event and whether it is an all-day event.
+// Floating times and all-day dates are interpreted in loc.
+// If DTEND is missing, the end is calculated from DURATION. Without either, all-day events last one day and
+// timed events end at their start, as defined in RFC 5545.
+func getEventTimes(event *ics.VEvent, loc *time.Location) (time.Time, time.Time, bool, error) {
+	start, allDay, err := parseICalTime(event.GetProperty(ics.ComponentPropertyDtStart), loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, false, fmt.Errorf("invalid DTSTART of event %s: %s", event.Id(), err.Error())
+	}
+	if endProp := event.GetProperty(ics.ComponentPropertyDtEnd); endProp != nil {
+		end, _, err := parseICalTime(endProp, loc)
+		if err != nil {
+			return start, start, allDay, fmt.Errorf("invalid DTEND of event %s: %s", event.Id(), err.Error())
+		}
+		return start, end, allDay, nil
+	}
+	if durationProp := event.GetProperty(ics.ComponentProperty(ics.PropertyDuration)); durationProp != nil {
+		duration, err := parseICalDuration(durationProp.Value)
+		if err != nil {
+			return start, start, allDay, fmt.Errorf("invalid DURATION of event %s: %s", event.Id(), err.Error())
+		}
+		return start, start.Add(duration), allDay, nil
+	}
+	if allDay {
+		return start, start.AddDate(0, 0, 1), allDay, nil
+	}
+	return start, start, allDay, nil
+}
+
+// isAllDay returns true, if the event, todo or journal entry has a DATE value as DTSTART
+func isAllDay(item *ics.ComponentBase) bool {
+	_, allDay, err := parseICalTime(item.GetProperty(ics.ComponentPropertyDtStart), time.UTC)
+	return err == nil && allDay
+}
+
+// setEventTimes sets DTSTART and DTEND of an event.
+// All-day events are written as DATE values, the date is taken as is, regardless of the location of start and end.
+// Timed events are written in UTC. An existing DURATION is removed, since it may not be combined with DTEND.
+func setEventTimes(event *ics.VEvent, start time.Time, end time.Time, allDay bool) {
+	if allDay {
+		event.SetProperty(ics.ComponentPropertyDtStart, start.Format(icalDateFormat), ics.WithValue(string(ics.ValueDataTypeDate)))
+		event.SetProperty(ics.ComponentPropertyDtEnd, end.Format(icalDateFormat), ics.WithValue(string(ics.ValueDataTypeDate)))
+	} else {
+		event.SetStartAt(start)
+		event.SetEndAt(end)
+	}
+	removePropertyByName(&event.ComponentBase, ics.ComponentProperty(ics.PropertyDuration))
+}
+
+// eventInTimeframe returns true, if the event, todo or journal entry starts after 'after' and before 'before'.
+// All-day events start at midnight in loc. Undated todos and journal entries are only in timeframes without end,
+// as if they were in the far future, so the immutable past doesn't duplicate them.
+func eventInTimeframe(component ics.Component, after time.Time, before time.Time, loc *time.Location) (bool, error) {
+	start, _, _, err := getItemTimes(component, loc)
+	if err == errUndated {
+		return before.Equal(maxTime), nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return start.After(after) && before.After(start), nil
+}
+
+// getParamLocation returns the timezone set in the module parameter 'timezone'.
+// getProfileCalendar sets it to the profile timezone, if the module doesn't set its own. Without it, the server timezone is used.
+func getParamLocation(params map[string]string) (*time.Location, error) {
+	if params["timezone"] == "" {
+		return conf.getServerLocation(), nil
+	}
+	loc, err := time.LoadLocation(params["timezone"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone '%s': %s", params["timezone"], err.Error())
+	}
+	return loc, nil
+}
+
+// parseEditTime parses a new start or end time given to an edit module.
+// A date without time ("2006-01-02") is an all-day date, everything else is parsed by parseTimeExpression.
+func parseEditTime(value string, loc *time.Location) (time.Time, bool, error) {
+	if t, err := time.ParseInLocation("2006-01-02", value, loc); err == nil {
+		return t, true, nil
+	}
+	t, err := parseTimeExpression(value, loc)
+	return t, false, err
+}
+
+// applyTimeEdits changes start and end of an event according to the parameters of the edit modules:
+// 'new-start', 'new-end', 'new-allday' and 'move-time'. The end of todos is their DUE, journal entries have no end.
+// Switching to all-day keeps the dates of the event, switching to timed without new times keeps the whole days.
+func applyTimeEdits(component ics.Component, params map[string]string, loc *time.Location) error {
+	if params["new-start"] == "" && params["new-end"] == "" && params["new-allday"] == "" && params["move-time"] == "" {
+		return nil
+	}
+	start, end, allDay, err := getItemTimes(component, loc)
+	if err == errUndated {
+		if params["new-start"] == "" && params["new-end"] == "" {
+			// nothing to move
+			return nil
+		}
+		// undated todos and journal entries start and end at the new time, until both are given
+		value := params["new-start"]
+		if value == "" {
+			value = params["new-end"]
+		}
+		start, allDay, err = parseEditTime(value, loc)
+		if err != nil {
+			return fmt.Errorf("invalid time: %s", err.Error())
+		}
+		end = start
+	}
+	if err != nil && params["new-start"] == "" {
+		return err
+	}
+	if params["new-start"] != "" {
+		wasAllDay := allDay
+		start, allDay, err = parseEditTime(params["new-start"], loc)
+		if err != nil {
+			return fmt.Errorf("invalid start time: %s", err.Error())
+		}
+		if params["new-end"] == "" && allDay != wasAllDay {
+			// the old end can't be used, if only the start is changed between date and time
+			if allDay {
+				end = start.AddDate(0, 0, 1)
+			} else {
+				end = start
+			}
+		}
+		log.Debug("Changed start to " + params["new-start"])
+	}
+	if params["new-end"] != "" {
+		var endAllDay bool
+		end, endAllDay, err = parseEditTime(params["new-end"], loc)
+		if err != nil {
+			return fmt.Errorf("invalid end time: %s", err.Error())
+		}
+		if endAllDay != allDay {
+			return fmt.Errorf("'new-start' and 'new-end' have to be both dates or both times")
+		}
+		log.Debug("Changed end to " + params["new-end"])
+	}
+	switch params["new-allday"] {
+	case "":
+	case "true":
+		if !allDay {
+			startDay := time.Date(start.In(loc).Year(), start.In(loc).Month(), start.In(loc).Day(), 0, 0, 0, 0, loc)
+			endDay := time.Date(end.In(loc).Year(), end.In(loc).Month(), end.In(loc).Day(), 0, 0, 0, 0, loc)
+			if !endDay.After(startDay) || end.In(loc) != endDay {
+				// the day the event ends on is part of the all-day event
+				endDay = endDay.AddDate(0, 0, 1)
+			}
+			start, end, allDay = startDay, endDay, true
+			log.Debug("Changed event to all-day")
+		}
+	case "false":
+		// the dates are already midnight in loc, so the event spans the same days
+		allDay = false
+		log.Debug("Changed event to timed")
+	default:
+		return fmt.Errorf("invalid value for 'new-allday': %s", params["new-allday"])
+	}
+	if params["move-time"] != "" {
+		dur, err := time.ParseDuration(params["move-time"])
+		if err != nil {
+			return fmt.Errorf("invalid duration: %s", err.Error())
+		}
+		if allDay && dur%(24*time.Hour) != 0 {
+			return fmt.Errorf("all-day events can only be moved by whole days")
+		}
+		if allDay {
+			start = start.AddDate(0, 0, int(dur/(24*time.Hour)))
+			end = end.AddDate(0, 0, int(dur/(24*time.Hour)))
+		} else {
+			start = start.Add(dur)
+			end = end.Add(dur)
+		}
+		log.Debug("Changed start and end by " + dur.String())
+	}
+	if end.Before(start) {
+		return fmt.Errorf("end of event %s would be before its start", getItemId(getItemBase(component)))
+	}
+	setItemTimes(component, start, end, allDay)
+	return nil
+}
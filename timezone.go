@@ -0,0 +1,268 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	ics "github.com/arran4/golang-ical"
+	log "github.com/sirupsen/logrus"
+)
+
+// these properties of events, todos and journal entries are converted by the normalize-timezone module
+var timezoneProperties = []ics.ComponentProperty{
+	ics.ComponentPropertyDtStart,
+	ics.ComponentPropertyDtEnd,
+	ics.ComponentProperty(ics.PropertyDue),
+	ics.ComponentProperty(ics.PropertyRecurrenceId),
+	ics.ComponentPropertyExdate,
+	ics.ComponentPropertyRdate,
+}
+
+// formatICalTime formats t as DATE-TIME value in target. UTC values end with "Z", others need a TZID parameter.
+func formatICalTime(t time.Time, target *time.Location) string {
+	if target == time.UTC {
+		return t.UTC().Format(icalDateTimeFormatUTC)
+	}
+	return t.In(target).Format(icalDateTimeFormatLocal)
+}
+
+// formatUTCOffset formats a UTC offset in seconds as TZOFFSETFROM/TZOFFSETTO value, e.g. "+0100" or "+0530"
+func formatUTCOffset(offset int) string {
+	sign := "+"
+	if offset < 0 {
+		sign = "-"
+		offset = -offset
+	}
+	value := fmt.Sprintf("%s%02d%02d", sign, offset/3600, offset%3600/60)
+	if offset%60 != 0 {
+		value += fmt.Sprintf("%02d", offset%60)
+	}
+	return value
+}
+
+// convertTimeProperty converts the DATE-TIME values of the property to target. DATE and PERIOD values are left unchanged.
+// Values without TZID and "Z" are read in loc. Returns the converted times.
+func convertTimeProperty(prop *ics.IANAProperty, loc *time.Location, target *time.Location) ([]time.Time, error) {
+	if value, ok := prop.ICalParameters[string(ics.ParameterValue)]; ok && len(value) > 0 && value[0] != string(ics.ValueDataTypeDateTime) {
+		return nil, nil
+	}
+	var times []time.Time
+	var values []string
+	for _, v := range strings.Split(prop.Value, ",") {
+		t, allDay, err := parseICalTime(&ics.IANAProperty{BaseProperty: ics.BaseProperty{IANAToken: prop.IANAToken, ICalParameters: prop.ICalParameters, Value: v}}, loc)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %s", prop.IANAToken, err.Error())
+		}
+		if allDay {
+			return nil, nil
+		}
+		times = append(times, t)
+		values = append(values, formatICalTime(t, target))
+	}
+	prop.Value = strings.Join(values, ",")
+	delete(prop.ICalParameters, string(ics.PropertyTzid))
+	if target != time.UTC {
+		if prop.ICalParameters == nil {
+			prop.ICalParameters = make(map[string][]string)
+		}
+		prop.ICalParameters[string(ics.PropertyTzid)] = []string{target.String()}
+	}
+	return times, nil
+}
+
+// convertRruleUntil converts the UNTIL of a RRULE to UTC, as required for DTSTART values with TZID.
+// Floating values are read in loc, the location of DTSTART. All-day values are left unchanged.
+func convertRruleUntil(prop *ics.IANAProperty, loc *time.Location) error {
+	parts := strings.Split(prop.Value, ";")
+	for i, part := range parts {
+		if !strings.HasPrefix(strings.ToUpper(part), "UNTIL=") {
+			continue
+		}
+		until, allDay, err := parseICalTime(&ics.IANAProperty{BaseProperty: ics.BaseProperty{Value: part[len("UNTIL="):]}}, loc)
+		if err != nil {
+			return fmt.Errorf("invalid UNTIL in RRULE: %s", err.Error())
+		}
+		if !allDay {
+			parts[i] = "UNTIL=" + until.UTC().Format(icalDateTimeFormatUTC)
+		}
+	}
+	prop.Value = strings.Join(parts, ";")
+	return nil
+}
+
+// findZoneTransitions returns the times in [from, until), at which the UTC offset or the name of the zone changes
+func findZoneTransitions(loc *time.Location, from time.Time, until time.Time) []time.Time {
+	var transitions []time.Time
+	prevName, prevOffset := from.In(loc).Zone()
+	for t := from.Add(24 * time.Hour); t.Before(until.Add(24 * time.Hour)); t = t.Add(24 * time.Hour) {
+		name, offset := t.In(loc).Zone()
+		if name == prevName && offset == prevOffset {
+			continue
+		}
+		// binary search for the second of the transition
+		lo, hi := t.Add(-24*time.Hour), t
+		for hi.Sub(lo) > time.Second {
+			mid := lo.Add(hi.Sub(lo) / 2)
+			if n, o := mid.In(loc).Zone(); n == prevName && o == prevOffset {
+				lo = mid
+			} else {
+				hi = mid
+			}
+		}
+		// transitions are at full seconds, the search stops within a second after it
+		hi = hi.Truncate(time.Second)
+		if hi.Before(until) {
+			transitions = append(transitions, hi)
+		}
+		prevName, prevOffset = name, offset
+	}
+	return transitions
+}
+
+// generateVTimezone generates a VTIMEZONE for loc, with an observance for every transition between from and until.
+// The transitions are listed explicitly instead of as RRULE, so past changes of the rules are correct, too.
+func generateVTimezone(loc *time.Location, from time.Time, until time.Time) *ics.VTimezone {
+	vtimezone := &ics.VTimezone{}
+	vtimezone.SetProperty(ics.ComponentProperty(ics.PropertyTzid), loc.String())
+	addObservance := func(t time.Time, prevOffset int) {
+		name, offset := t.In(loc).Zone()
+		observance := ics.ComponentBase{}
+		// the start of an observance is written in the local time before it
+		observance.SetProperty(ics.ComponentPropertyDtStart, t.In(time.FixedZone("", prevOffset)).Format(icalDateTimeFormatLocal))
+		observance.SetProperty(ics.ComponentProperty(ics.PropertyTzoffsetfrom), formatUTCOffset(prevOffset))
+		observance.SetProperty(ics.ComponentProperty(ics.PropertyTzoffsetto), formatUTCOffset(offset))
+		if name != "" && !strings.HasPrefix(name, "+") && !strings.HasPrefix(name, "-") {
+			observance.SetProperty(ics.ComponentProperty(ics.PropertyTzname), name)
+		}
+		if t.In(loc).IsDST() {
+			vtimezone.Components = append(vtimezone.Components, &ics.Daylight{ComponentBase: observance})
+		} else {
+			vtimezone.Components = append(vtimezone.Components, &ics.Standard{ComponentBase: observance})
+		}
+	}
+	_, offset := from.In(loc).Zone()
+	addObservance(from, offset)
+	for _, t := range findZoneTransitions(loc, from, until) {
+		addObservance(t, offset)
+		_, offset = t.In(loc).Zone()
+	}
+	return vtimezone
+}
+
+// getReferencedTZIDs returns the TZID parameters used by the properties of the components and their subcomponents
+func getReferencedTZIDs(components []ics.Component, tzids map[string]bool) {
+	for _, component := range components {
+		for _, p := range component.UnknownPropertiesIANAProperties() {
+			for _, tzid := range p.ICalParameters[string(ics.PropertyTzid)] {
+				tzids[tzid] = true
+			}
+		}
+		getReferencedTZIDs(component.SubComponents(), tzids)
+	}
+}
+
+// This module converts the times of all events, todos and journal entries to one timezone, with a matching VTIMEZONE, or to UTC.
+// DTSTART, DTEND, DUE, RECURRENCE-ID, EXDATE and RDATE are converted, the UNTIL of RRULEs is written in UTC.
+// All-day dates are not changed. VTIMEZONEs which are no longer used are removed.
+// Recurring events keep their time in the target timezone, so they move, if the daylight saving time rules differ.
+// Parameters:
+// - 'target', mandatory: the TZID to convert to, e.g. "Europe/Berlin", or "UTC"
+// - 'timezone', optional: timezone to read floating times in, default is the timezone of the profile
+// Returns the number of events removed or added (always 0).
+func moduleNormalizeTimezone(cal *ics.Calendar, params map[string]string) (int, error) {
+	if params["target"] == "" {
+		return 0, fmt.Errorf("missing mandatory Parameter 'target'")
+	}
+	target, err := time.LoadLocation(params["target"])
+	if err != nil {
+		return 0, fmt.Errorf("invalid target timezone '%s': %s", params["target"], err.Error())
+	}
+	loc, err := getParamLocation(params)
+	if err != nil {
+		return 0, err
+	}
+
+	var first, last time.Time
+	for _, component := range cal.Components {
+		item := getItemBase(component)
+		if item == nil {
+			continue
+		}
+		id := getItemId(item)
+		// UNTIL is relative to the original location of DTSTART, so it is converted first
+		startLoc := loc
+		if start := item.GetProperty(ics.ComponentPropertyDtStart); start != nil {
+			if tzid, ok := start.ICalParameters[string(ics.PropertyTzid)]; ok && len(tzid) > 0 {
+				startLoc, err = time.LoadLocation(tzid[0])
+				if err != nil {
+					log.Warnf("Skipping event %s: unknown TZID '%s'", id, tzid[0])
+					continue
+				}
+			}
+		}
+		for i := range item.Properties {
+			prop := &item.Properties[i]
+			if prop.IANAToken == string(ics.ComponentPropertyRrule) {
+				if err := convertRruleUntil(prop, startLoc); err != nil {
+					log.Warnf("Skipping RRULE of event %s: %s", id, err.Error())
+				}
+				continue
+			}
+			if !containsProperty(timezoneProperties, ics.ComponentProperty(prop.IANAToken)) {
+				continue
+			}
+			times, err := convertTimeProperty(prop, loc, target)
+			if err != nil {
+				log.Warnf("Skipping %s of event %s: %s", prop.IANAToken, id, err.Error())
+				continue
+			}
+			for _, t := range times {
+				if first.IsZero() || t.Before(first) {
+					first = t
+				}
+				if t.After(last) {
+					last = t
+				}
+			}
+		}
+		log.Debug("Converted times of " + getItemType(component) + " with id " + id + " to " + target.String() + "\n")
+	}
+
+	// remove VTIMEZONEs, which are replaced or no longer used
+	tzids := make(map[string]bool)
+	getReferencedTZIDs(cal.Components, tzids)
+	for i := len(cal.Components) - 1; i >= 0; i-- {
+		switch cal.Components[i].(type) {
+		case *ics.VTimezone:
+			tzid := getPropertyValue(&cal.Components[i].(*ics.VTimezone).ComponentBase, ics.ComponentProperty(ics.PropertyTzid))
+			if !tzids[tzid] || tzid == target.String() {
+				cal.Components = removeFromICS(cal.Components, i)
+			}
+		}
+	}
+	if target != time.UTC && !first.IsZero() {
+		// cover recurring events for a few years
+		until := last
+		if now := time.Now(); now.After(until) {
+			until = now
+		}
+		until = until.AddDate(5, 0, 0)
+		if first.Before(until.AddDate(-200, 0, 0)) {
+			first = until.AddDate(-200, 0, 0)
+		}
+		cal.Components = append([]ics.Component{generateVTimezone(target, first.AddDate(0, 0, -1), until)}, cal.Components...)
+	}
+	cal.SetXWRTimezone(target.String())
+	return 0, nil
+}
+
+// containsProperty returns true, if the list contains the property
+func containsProperty(properties []ics.ComponentProperty, property ics.ComponentProperty) bool {
+	for _, p := range properties {
+		if p == property {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	ics "github.com/arran4/golang-ical"
+)
+
+func TestFormatUTCOffset(t *testing.T) {
+	for offset, want := range map[int]string{0: "+0000", 3600: "+0100", -5 * 3600: "-0500", 19800: "+0530", -(3600 + 30*60 + 15): "-013015"} {
+		if got := formatUTCOffset(offset); got != want {
+			t.Errorf("formatUTCOffset(%d) = %s, want %s", offset, got, want)
+		}
+	}
+}
+
+func TestGenerateVTimezone(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	until := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	transitions := findZoneTransitions(berlin, from, until)
+	if len(transitions) != 2 || !transitions[0].Equal(time.Date(2024, 3, 31, 1, 0, 0, 0, time.UTC)) ||
+		!transitions[1].Equal(time.Date(2024, 10, 27, 1, 0, 0, 0, time.UTC)) {
+		t.Fatalf("transitions of Europe/Berlin in 2024 = %v", transitions)
+	}
+
+	vtimezone := generateVTimezone(berlin, from, until)
+	if tzid := getPropertyValue(&vtimezone.ComponentBase, ics.ComponentProperty(ics.PropertyTzid)); tzid != "Europe/Berlin" {
+		t.Errorf("TZID = %s", tzid)
+	}
+	var observances []string
+	for _, c := range vtimezone.Components {
+		var kind string
+		var observance *ics.ComponentBase
+		switch c := c.(type) {
+		case *ics.Standard:
+			kind, observance = "STANDARD", &c.ComponentBase
+		case *ics.Daylight:
+			kind, observance = "DAYLIGHT", &c.ComponentBase
+		}
+		observances = append(observances, strings.Join([]string{kind,
+			getPropertyValue(observance, ics.ComponentPropertyDtStart),
+			getPropertyValue(observance, ics.ComponentProperty(ics.PropertyTzoffsetfrom)),
+			getPropertyValue(observance, ics.ComponentProperty(ics.PropertyTzoffsetto)),
+			getPropertyValue(observance, ics.ComponentProperty(ics.PropertyTzname)),
+		}, " "))
+	}
+	want := []string{
+		"STANDARD 20240101T010000 +0100 +0100 CET",
+		// the start is the local time before the transition
+		"DAYLIGHT 20240331T020000 +0100 +0200 CEST",
+		"STANDARD 20241027T030000 +0200 +0100 CET",
+	}
+	if strings.Join(observances, "\n") != strings.Join(want, "\n") {
+		t.Errorf("observances =\n%s\nwant\n%s", strings.Join(observances, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestModuleNormalizeTimezone(t *testing.T) {
+	items := `BEGIN:VTIMEZONE
+TZID:America/New_York
+BEGIN:STANDARD
+DTSTART:19701101T020000
+TZOFFSETFROM:-0400
+TZOFFSETTO:-0500
+END:STANDARD
+END:VTIMEZONE
+BEGIN:VEVENT
+UID:new-york
+DTSTAMP:20240101T000000Z
+DTSTART;TZID=America/New_York:20240105T100000
+DTEND;TZID=America/New_York:20240105T110000
+RRULE:FREQ=WEEKLY;UNTIL=20240126T100000
+EXDATE;TZID=America/New_York:20240112T100000,20240119T100000
+SUMMARY:Call
+END:VEVENT
+BEGIN:VEVENT
+UID:utc
+DTSTAMP:20240101T000000Z
+DTSTART:20240701T100000Z
+DTEND:20240701T110000Z
+SUMMARY:Sommer
+END:VEVENT
+BEGIN:VEVENT
+UID:floating
+DTSTAMP:20240101T000000Z
+DTSTART:20240105T100000
+DTEND:20240105T110000
+SUMMARY:Ortszeit
+END:VEVENT
+BEGIN:VEVENT
+UID:allday
+DTSTAMP:20240101T000000Z
+DTSTART;VALUE=DATE:20240105
+DTEND;VALUE=DATE:20240106
+SUMMARY:Ganztags
+END:VEVENT`
+
+	properties := func(cal *ics.Calendar) map[string]string {
+		values := make(map[string]string)
+		for _, event := range cal.Events() {
+			for _, p := range event.Properties {
+				var tzid string
+				if v := p.ICalParameters[string(ics.PropertyTzid)]; len(v) > 0 {
+					tzid = ";TZID=" + v[0]
+				}
+				values[event.Id()+" "+p.IANAToken] = p.IANAToken + tzid + ":" + p.Value
+			}
+		}
+		return values
+	}
+
+	cal := testCalendar(t, items)
+	if _, err := moduleNormalizeTimezone(cal, map[string]string{"target": "Europe/Berlin", "timezone": "UTC"}); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"new-york DTSTART": "DTSTART;TZID=Europe/Berlin:20240105T160000",
+		"new-york DTEND":   "DTEND;TZID=Europe/Berlin:20240105T170000",
+		// UNTIL is read in the timezone of DTSTART and written in UTC
+		"new-york RRULE":  "RRULE:FREQ=WEEKLY;UNTIL=20240126T150000Z",
+		"new-york EXDATE": "EXDATE;TZID=Europe/Berlin:20240112T160000,20240119T160000",
+		"utc DTSTART":     "DTSTART;TZID=Europe/Berlin:20240701T120000",
+		"floating DTEND":  "DTEND;TZID=Europe/Berlin:20240105T120000",
+		"allday DTSTART":  "DTSTART:20240105",
+	}
+	got := properties(cal)
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("%s = %s, want %s", key, got[key], value)
+		}
+	}
+	var tzids []string
+	for _, c := range cal.Components {
+		if vtimezone, ok := c.(*ics.VTimezone); ok {
+			tzids = append(tzids, getPropertyValue(&vtimezone.ComponentBase, ics.ComponentProperty(ics.PropertyTzid)))
+		}
+	}
+	if strings.Join(tzids, ",") != "Europe/Berlin" {
+		t.Errorf("VTIMEZONEs = %v, want only Europe/Berlin", tzids)
+	}
+	if !strings.Contains(cal.Serialize(), "X-WR-TIMEZONE:Europe/Berlin") {
+		t.Error("X-WR-TIMEZONE isn't set")
+	}
+
+	// UTC needs no VTIMEZONE
+	cal = testCalendar(t, items)
+	if _, err := moduleNormalizeTimezone(cal, map[string]string{"target": "UTC", "timezone": "Europe/Berlin"}); err != nil {
+		t.Fatal(err)
+	}
+	got = properties(cal)
+	if got["new-york DTSTART"] != "DTSTART:20240105T150000Z" || got["floating DTSTART"] != "DTSTART:20240105T090000Z" {
+		t.Errorf("times in UTC = %s, %s", got["new-york DTSTART"], got["floating DTSTART"])
+	}
+	for _, c := range cal.Components {
+		if _, ok := c.(*ics.VTimezone); ok {
+			t.Error("VTIMEZONE left after conversion to UTC")
+		}
+	}
+
+	for _, params := range []map[string]string{{}, {"target": "Europe/Nowhere"}} {
+		if _, err := moduleNormalizeTimezone(testCalendar(t, items), params); err == nil {
+			t.Errorf("moduleNormalizeTimezone(%v): expected an error", params)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	ics "github.com/arran4/golang-ical"
+	log "github.com/sirupsen/logrus"
+)
+
+// travelMatrix holds the travel times between location keys. Pairs are symmetric, unless both directions are listed.
+type travelMatrix struct {
+	times       map[[2]string]time.Duration
+	defaultTime time.Duration
+}
+
+// get returns the travel time from one location key to another. Equal keys need no travel time.
+func (m travelMatrix) get(from string, to string) time.Duration {
+	if from == to {
+		return 0
+	}
+	if d, ok := m.times[[2]string{from, to}]; ok {
+		return d
+	}
+	return m.defaultTime
+}
+
+// parseTravelMatrix parses the travel-time matrix in CSV format, "from,to,duration" per line, e.g. "A,B,15m".
+// Lines starting with # are comments.
+func parseTravelMatrix(data string) (map[[2]string]time.Duration, error) {
+	r := csv.NewReader(strings.NewReader(data))
+	r.Comment = '#'
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %s", err.Error())
+	}
+	times := make(map[[2]string]time.Duration)
+	explicit := make(map[[2]string]bool)
+	for i, record := range records {
+		if len(record) != 3 {
+			return nil, fmt.Errorf("invalid travel matrix: line %d has %d fields instead of 3 (from,to,duration)", i+1, len(record))
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(record[2]))
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("invalid travel matrix: invalid duration '%s' in line %d", record[2], i+1)
+		}
+		from, to := strings.TrimSpace(record[0]), strings.TrimSpace(record[1])
+		times[[2]string{from, to}] = d
+		explicit[[2]string{from, to}] = true
+		if !explicit[[2]string{to, from}] {
+			times[[2]string{to, from}] = d
+		}
+	}
+	return times, nil
+}
+
+// parseTravelParams checks the parameters of the travel-time module and returns the matrix and the regex for location keys.
+// The matrix file is only read, if readFile is set.
+func parseTravelParams(params map[string]string, readFile bool) (travelMatrix, *regexp.Regexp, error) {
+	matrix := travelMatrix{}
+	if (params["file"] == "") == (params["matrix"] == "") {
+		return matrix, nil, fmt.Errorf("exactly one of the parameters 'file' and 'matrix' is mandatory")
+	}
+	data := params["matrix"]
+	if params["file"] != "" && readFile {
+		content, err := ioutil.ReadFile(params["file"])
+		if err != nil {
+			return matrix, nil, fmt.Errorf("error reading travel matrix: %s", err.Error())
+		}
+		data = string(content)
+	}
+	var err error
+	matrix.times, err = parseTravelMatrix(data)
+	if err != nil {
+		return matrix, nil, err
+	}
+	if params["default"] != "" {
+		matrix.defaultTime, err = time.ParseDuration(params["default"])
+		if err != nil || matrix.defaultTime < 0 {
+			return matrix, nil, fmt.Errorf("invalid value for 'default': %s", params["default"])
+		}
+	}
+	for _, p := range []string{"max-gap", "alarm-before"} {
+		if params[p] != "" {
+			if d, err := time.ParseDuration(params[p]); err != nil || d < 0 {
+				return matrix, nil, fmt.Errorf("invalid value for '%s': %s", p, params[p])
+			}
+		}
+	}
+	switch params["mode"] {
+	case "", "event", "alarm":
+	default:
+		return matrix, nil, fmt.Errorf("invalid mode '%s', must be 'event' or 'alarm'", params["mode"])
+	}
+	var keyRegex *regexp.Regexp
+	if params["key-regex"] != "" {
+		keyRegex, err = regexp.Compile(params["key-regex"])
+		if err != nil {
+			return matrix, nil, fmt.Errorf("invalid regex in 'key-regex': %s", err.Error())
+		}
+	}
+	return matrix, keyRegex, nil
+}
+
+// getLocationKey returns the key of the location of the event for the travel matrix.
+// With keyRegex, it is the first capture group or the whole match, otherwise the whole location. It is empty, if there is none.
+func getLocationKey(event *ics.VEvent, keyRegex *regexp.Regexp) string {
+	location := strings.TrimSpace(ics.FromText(getPropertyValue(&event.ComponentBase, ics.ComponentPropertyLocation)))
+	if keyRegex == nil || location == "" {
+		return location
+	}
+	m := keyRegex.FindStringSubmatch(location)
+	switch {
+	case m == nil:
+		return ""
+	case len(m) > 1:
+		return strings.TrimSpace(m[1])
+	}
+	return strings.TrimSpace(m[0])
+}
+
+// This module adds travel time between consecutive events in different locations, using an offline travel-time matrix
+// between location keys, e.g. buildings. Either a "Travel" blocker event is inserted before the later event, or an alarm
+// is added to it, which reminds to leave in time. Cancelled, transparent (free), all-day and overlapping events are ignored.
+// Parameters:
+// - 'matrix' or 'file', one is mandatory: the travel-time matrix in CSV format, "from,to,duration" per line, e.g. "A,B,15m",
+// or the path of a file containing it. Pairs apply in both directions, unless the other direction is listed, too.
+// 'file' is not allowed for low-privilege users.
+// - 'key-regex', optional: regex to get the location key from LOCATION, the first capture group or the whole match is used,
+// e.g. "^([A-Z])[0-9]" for the building letter of room numbers. Default is the whole location.
+// - 'default', optional: travel time between different locations, which aren't in the matrix. Default is no travel time.
+// - 'max-gap', default "2h": events further apart aren't consecutive, e.g. the first event of the next day
+// - 'mode', default "event": "event" inserts a blocker event ending at the start of the later event, "alarm" adds an alarm to it
+// - 'summary', default "Travel": summary of the blocker events
+// - 'alarm-before', optional: additional time before leaving for the alarms, e.g. "5m"
+// - match rules, 'combine', 'after', 'before', 'period', optional: only consider matching events, see parseEventMatcher
+// Returns the number of events added.
+func moduleTravelTime(cal *ics.Calendar, params map[string]string) (int, error) {
+	matrix, keyRegex, err := parseTravelParams(params, true)
+	if err != nil {
+		return 0, err
+	}
+	if params["max-gap"] == "" {
+		params["max-gap"] = "2h"
+	}
+	maxGap, _ := time.ParseDuration(params["max-gap"])
+	alarmBefore, _ := time.ParseDuration(params["alarm-before"])
+	if params["summary"] == "" {
+		params["summary"] = "Travel"
+	}
+	loc, err := getParamLocation(params)
+	if err != nil {
+		return 0, err
+	}
+	matcher, err := parseEventMatcher(params)
+	if err != nil {
+		return 0, err
+	}
+
+	type locatedEvent struct {
+		timedEvent
+		key string
+	}
+	var events []locatedEvent
+	for _, event := range cal.Events() {
+		if event.GetProperty("X-ICAL-RELAY-TRAVEL") != nil ||
+			getPropertyValue(&event.ComponentBase, ics.ComponentPropertyStatus) == string(ics.ObjectStatusCancelled) ||
+			getPropertyValue(&event.ComponentBase, ics.ComponentPropertyTransp) == string(ics.TransparencyTransparent) {
+			continue
+		}
+		matched, err := matcher.matches(event)
+		if err != nil {
+			log.Warnf("Skipping event: %s", err.Error())
+			continue
+		}
+		if !matched {
+			continue
+		}
+		start, end, allDay, err := getEventTimes(event, loc)
+		if err != nil {
+			log.Warnf("Skipping event: %s", err.Error())
+			continue
+		}
+		if allDay {
+			continue
+		}
+		events = append(events, locatedEvent{timedEvent{event: event, start: start, end: end}, getLocationKey(event, keyRegex)})
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].start.Before(events[j].start) })
+
+	var count int
+	for i := 1; i < len(events); i++ {
+		prev, next := events[i-1], events[i]
+		if prev.key == "" || next.key == "" || next.start.Before(prev.end) || next.start.Sub(prev.end) > maxGap {
+			continue
+		}
+		travel := matrix.get(prev.key, next.key)
+		if travel == 0 {
+			continue
+		}
+		// whole minutes, rounded up, e.g. "12 min"
+		description := fmt.Sprintf("%s → %s (%d min)", prev.key, next.key, int(math.Ceil(travel.Minutes())))
+		switch params["mode"] {
+		case "alarm":
+			alarm := next.event.AddAlarm()
+			alarm.SetAction(ics.ActionDisplay)
+			alarm.SetTrigger(formatICalDuration(-(travel + alarmBefore)))
+			alarm.SetProperty(ics.ComponentPropertyDescription, ics.ToText(description))
+			log.Debug("Added travel alarm to event with id " + next.event.Id() + "\n")
+		default:
+			start := next.start.Add(-travel)
+			if start.Before(prev.end) {
+				start = prev.end
+				description += ", not enough time"
+			}
+			if !start.Before(next.start) {
+				log.Debug("No time to travel to event with id " + next.event.Id() + "\n")
+				continue
+			}
+			uid := fmt.Sprintf("travel-%x@ical-relay", sha256.Sum256([]byte(prev.event.Id()+"\n"+next.event.Id())))
+			event := cal.AddEvent(uid)
+			event.SetSummary(params["summary"])
+			event.SetDescription(description)
+			event.SetDtStampTime(time.Now())
+			event.SetProperty("X-ICAL-RELAY-TRAVEL", ics.ToText(next.event.Id()))
+			setEventTimes(event, start, next.start, false)
+			count++
+			log.Debug("Added travel event before event with id " + next.event.Id() + "\n")
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	ics "github.com/arran4/golang-ical"
+)
+
+func TestParseTravelMatrix(t *testing.T) {
+	times, err := parseTravelMatrix("# building, building, time\nA,B,15m\nB, C, 1m30s\nC,B,5m\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	matrix := travelMatrix{times: times, defaultTime: 20 * time.Minute}
+	tests := []struct {
+		from, to string
+		want     time.Duration
+	}{
+		{"A", "B", 15 * time.Minute},
+		{"B", "A", 15 * time.Minute},
+		// both directions are listed
+		{"B", "C", 90 * time.Second},
+		{"C", "B", 5 * time.Minute},
+		{"A", "A", 0},
+		{"A", "D", 20 * time.Minute},
+	}
+	for _, test := range tests {
+		if got := matrix.get(test.from, test.to); got != test.want {
+			t.Errorf("travel time from %s to %s = %v, want %v", test.from, test.to, got, test.want)
+		}
+	}
+
+	for _, data := range []string{"A,B", "A,B,15m,x", "A,B,soon", "A,B,-5m", "A,\"B,15m"} {
+		if _, err := parseTravelMatrix(data); err == nil {
+			t.Errorf("parseTravelMatrix(%q): expected an error", data)
+		}
+	}
+}
+
+func TestModuleTravelTime(t *testing.T) {
+	events := strings.Join([]string{
+		testEvent("a", "Analysis", "20240105T080000", "20240105T094500", "LOCATION:A1.01"),
+		// 15 minutes gap, 20 minutes travel from A to B
+		testEvent("b", "Biologie", "20240105T100000", "20240105T110000", "LOCATION:B2.14"),
+		// same building
+		testEvent("c", "Chemie", "20240105T113000", "20240105T120000", "LOCATION:B0.01"),
+		// 90 seconds travel from B to C, rounded up to 2 minutes
+		testEvent("d", "Deutsch", "20240105T130000", "20240105T140000", "LOCATION:C1"),
+		// more than max-gap later
+		testEvent("e", "Englisch", "20240105T170000", "20240105T180000", "LOCATION:A1.01"),
+		// overlapping and free events are ignored
+		testEvent("f", "Frei", "20240105T165000", "20240105T170000", "LOCATION:B1", "TRANSP:TRANSPARENT"),
+	}, "\n")
+	matrix := "A,B,20m\nB,C,1m30s"
+
+	cal := testCalendar(t, events)
+	count, err := moduleTravelTime(cal, map[string]string{"matrix": matrix, "key-regex": "^([A-Z])", "timezone": "UTC"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var travel []string
+	for _, event := range cal.Events() {
+		if event.GetProperty("X-ICAL-RELAY-TRAVEL") == nil {
+			continue
+		}
+		start, end, _, err := getEventTimes(event, time.UTC)
+		if err != nil {
+			t.Fatal(err)
+		}
+		travel = append(travel, start.Format("1504")+"-"+end.Format("1504")+" "+
+			getPropertyValue(&event.ComponentBase, ics.ComponentPropertySummary)+": "+ics.FromText(getPropertyValue(&event.ComponentBase, ics.ComponentPropertyDescription)))
+	}
+	want := []string{
+		"0945-1000 Travel: A → B (20 min), not enough time",
+		"1258-1300 Travel: B → C (2 min)",
+	}
+	if count != 2 || strings.Join(travel, "\n") != strings.Join(want, "\n") {
+		t.Errorf("moduleTravelTime = %d, added\n%s\nwant\n%s", count, strings.Join(travel, "\n"), strings.Join(want, "\n"))
+	}
+
+	// alarm mode adds alarms instead of events
+	cal = testCalendar(t, events)
+	count, err = moduleTravelTime(cal, map[string]string{"matrix": matrix, "key-regex": "^([A-Z])", "mode": "alarm", "alarm-before": "5m", "timezone": "UTC"})
+	if err != nil || count != 0 {
+		t.Fatalf("moduleTravelTime in alarm mode = %d, %v", count, err)
+	}
+	triggers := make(map[string]string)
+	for _, event := range cal.Events() {
+		for _, alarm := range event.Alarms() {
+			triggers[event.Id()] = getPropertyValue(&alarm.ComponentBase, ics.ComponentPropertyTrigger) + " " +
+				ics.FromText(getPropertyValue(&alarm.ComponentBase, ics.ComponentPropertyDescription))
+		}
+	}
+	if len(triggers) != 2 || triggers["b"] != "-PT25M A → B (20 min)" || triggers["d"] != "-PT6M30S B → C (2 min)" {
+		t.Errorf("travel alarms = %v", triggers)
+	}
+
+	for _, params := range []map[string]string{
+		{},
+		{"matrix": matrix, "file": "/tmp/matrix.csv"},
+		{"matrix": matrix, "mode": "walk"},
+		{"matrix": matrix, "default": "-1m"},
+		{"matrix": matrix, "max-gap": "long"},
+		{"matrix": matrix, "key-regex": "("},
+	} {
+		if _, err := moduleTravelTime(testCalendar(t, events), params); err == nil {
+			t.Errorf("moduleTravelTime(%v): expected an error", params)
+		}
+	}
+}